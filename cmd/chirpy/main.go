@@ -1,27 +1,65 @@
 package main
 
 import (
+	"cmp"
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"syscall"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 
+	"github.com/mashfeii/chirpy/internal/application/jobs"
+	"github.com/mashfeii/chirpy/internal/application/outbox"
 	"github.com/mashfeii/chirpy/internal/domain"
 	"github.com/mashfeii/chirpy/internal/infrastructure/api"
 	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+	"github.com/mashfeii/chirpy/internal/infrastructure/logging"
+	"github.com/mashfeii/chirpy/internal/infrastructure/metrics"
+	"github.com/mashfeii/chirpy/internal/infrastructure/tracing"
+	"github.com/mashfeii/chirpy/pkg/blobstore"
+	"github.com/mashfeii/chirpy/pkg/fanout"
+	"github.com/mashfeii/chirpy/pkg/ratelimit"
+	"github.com/mashfeii/chirpy/pkg/ttlcache"
+	"github.com/mashfeii/chirpy/pkg/webhook"
+)
+
+const (
+	// drainPeriod gives load balancers time to notice the failing readiness
+	// probe before the server stops accepting connections.
+	drainPeriod     = 5 * time.Second
+	shutdownTimeout = 10 * time.Second
+	// statsFlushInterval bounds how long usage stats stay buffered in memory.
+	statsFlushInterval = 10 * time.Second
 )
 
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	slog.SetDefault(logging.New(os.Stdout, slog.LevelInfo))
+
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatalf("error loading .env file: %s", err.Error())
 	}
 
+	shutdownTracing, err := tracing.Setup(ctx, os.Getenv("TRACE_EXPORTER"))
+	if err != nil {
+		log.Fatalf("unable to set up tracing: %s", err.Error())
+	}
+
 	DBUrl := os.Getenv("DB_URL")
 
 	db, err := sql.Open("postgres", DBUrl)
@@ -29,43 +67,311 @@ func main() {
 		log.Fatalf("unable to connect to database: %s", err.Error())
 	}
 
-	queries := database.New(db)
+	appMetrics := metrics.New()
+
+	wrapDB := func(db database.DBTX) database.DBTX {
+		return tracing.TraceDB(logging.LogDB(appMetrics.InstrumentDB(db)))
+	}
+
+	queries := database.New(wrapDB(db))
+
+	appMetrics.RegisterActiveSessions(queries.CountActiveRefreshTokens)
+
+	rateLimits, err := domain.ParseRateLimits(os.Getenv("RATE_LIMITS"))
+	if err != nil {
+		log.Fatalf("invalid rate limits: %s", err.Error())
+	}
+
+	blobStore, privateBlobStore, mediaHandler, err := openBlobStore()
+	if err != nil {
+		log.Fatalf("unable to open media storage: %s", err.Error())
+	}
+
+	maxMediaBytes := int64(domain.DefaultMaxMediaBytes)
+
+	if raw := os.Getenv("MEDIA_MAX_BYTES"); raw != "" {
+		maxMediaBytes, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || maxMediaBytes <= 0 {
+			log.Fatalf("invalid MEDIA_MAX_BYTES %q", raw)
+		}
+	}
+
+	mediaWorkers := runtime.NumCPU()
+
+	if raw := os.Getenv("MEDIA_WORKERS"); raw != "" {
+		mediaWorkers, err = strconv.Atoi(raw)
+		if err != nil || mediaWorkers <= 0 {
+			log.Fatalf("invalid MEDIA_WORKERS %q", raw)
+		}
+	}
+
+	trustedProxies, err := api.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %s", err.Error())
+	}
+
+	accountDeletionGrace := domain.DefaultAccountDeletionGrace
+
+	if raw := os.Getenv("ACCOUNT_DELETION_GRACE"); raw != "" {
+		accountDeletionGrace, err = time.ParseDuration(raw)
+		if err != nil || accountDeletionGrace < 0 {
+			log.Fatalf("invalid ACCOUNT_DELETION_GRACE %q", raw)
+		}
+	}
+
+	if os.Getenv("POLKA_KEY") == "" {
+		slog.Warn("POLKA_KEY is not set, Polka webhooks will be rejected")
+	}
 
 	conf := domain.APIConfig{
-		Database: queries,
-		Platform: os.Getenv("PLATFORM"),
-		Secret:   os.Getenv("SECRET"),
-		Polka:    os.Getenv("POLKA_KEY"),
+		Metrics:              appMetrics,
+		Database:             queries,
+		Transactor:           database.NewTransactor(db, wrapDB),
+		RateLimiter:          ratelimit.NewMemoryStore(),
+		RateLimits:           rateLimits,
+		TierCache:            ttlcache.New[uuid.UUID, domain.Tier](domain.TierCacheTTL),
+		Stats:                domain.NewStatBuffer(),
+		WebhookSender:        webhook.NewSender(webhook.NewClient(domain.WebhookTimeout)),
+		StreamHub:            fanout.New[domain.StreamMessage](domain.StreamBufferSize),
+		BlobStore:            blobStore,
+		PrivateBlobStore:     privateBlobStore,
+		MaxMediaBytes:        maxMediaBytes,
+		MediaWorkers:         mediaWorkers,
+		AccountDeletionGrace: accountDeletionGrace,
+		Platform:             os.Getenv("PLATFORM"),
+		Secret:               os.Getenv("SECRET"),
+		Polka:                os.Getenv("POLKA_KEY"),
 	}
 
+	// Events reach the in-process bus through Postgres NOTIFY, so every
+	// replica sees the events dispatched by any of them.
+	bus := outbox.NewBus()
+	bus.Subscribe(conf.PublishToStream)
+	bus.Subscribe(conf.InvalidateUserCaches)
+
+	dispatcher := outbox.NewDispatcher(conf.Transactor)
+	dispatcher.Register("log", outbox.LogSink{})
+	dispatcher.Register("webhooks", outbox.SinkFunc(conf.QueueWebhookDeliveries))
+	dispatcher.Register("notifications", outbox.SinkFunc(conf.CreateNotifications))
+	dispatcher.Register("notify", outbox.NotifySink{})
+
 	mux := http.NewServeMux()
+
+	// ClientIP is resolved first, for the logs, traces and rate limits.
+	handler := api.MiddlewareClientIP(trustedProxies,
+		api.MiddlewareLog(tracing.Middleware(appMetrics.Middleware(conf.MiddlewareRateLimit(mux)))))
+
 	server := http.Server{
 		Addr:              ":8080",
-		Handler:           mux,
+		Handler:           handler,
 		ReadHeaderTimeout: 5 * time.Millisecond,
 	}
 
+	// Shutdown neither waits for nor closes hijacked WebSocket connections and
+	// would wait on SSE streams until its timeout, so streams are ended first.
+	server.RegisterOnShutdown(conf.StreamHub.Close)
+
 	fileHandler := http.StripPrefix("/app/", http.FileServer(http.Dir("./public")))
 
-	mux.Handle("/app/", api.MiddlewareLog(conf.MiddlewareInc(fileHandler)))
+	mux.Handle("/app/", conf.MiddlewareInc(fileHandler))
+
+	if mediaHandler != nil {
+		mux.Handle("GET /media/", mediaHandler)
+	}
 
 	mux.HandleFunc("POST /admin/reset", conf.ResetHandler)
+	mux.HandleFunc("GET /admin/metrics", conf.MiddlewareAdmin(conf.AdminMetricsHandler))
+	mux.HandleFunc("GET /admin/metrics.json", conf.MiddlewareAdmin(conf.AdminMetricsJSONHandler))
+	mux.HandleFunc("GET /admin/reports", conf.MiddlewareAdmin(conf.ShowReportsHandler))
+	mux.HandleFunc("GET /admin/reports/{report_id}", conf.MiddlewareAdmin(conf.ShowReportHandler))
+	mux.HandleFunc("POST /admin/reports/{report_id}/triage", conf.MiddlewareAdmin(conf.TriageReportHandler))
+	mux.HandleFunc("POST /admin/reports/{report_id}/resolve", conf.MiddlewareAdmin(conf.ResolveReportHandler))
+	mux.HandleFunc("GET /admin/moderation/actions", conf.MiddlewareAdmin(conf.ShowModerationActionsHandler))
+	mux.HandleFunc("POST /admin/users/{user_id}/suspend", conf.MiddlewareAdmin(conf.SuspendUserHandler))
+	mux.HandleFunc("POST /admin/users/{user_id}/unsuspend", conf.MiddlewareAdmin(conf.UnsuspendUserHandler))
+	mux.HandleFunc("POST /admin/users/{user_id}/deactivate", conf.MiddlewareAdmin(conf.DeactivateUserHandler))
+	mux.HandleFunc("POST /admin/users/{user_id}/reactivate", conf.MiddlewareAdmin(conf.ReactivateUserHandler))
+
+	mux.Handle("GET /metrics", appMetrics.Handler())
+
+	readiness := api.NewReadiness(2 * time.Second)
+	readiness.AddCheck("database", db.PingContext)
+	readiness.AddCheck("migrations", func(ctx context.Context) error {
+		err := database.CheckSchemaVersion(ctx, db)
+		if errors.Is(err, database.ErrSchemaAhead) {
+			return api.Notice(err.Error())
+		}
+
+		return err
+	})
+
+	mux.HandleFunc("GET /healthz", api.HealthHandler)
+	mux.HandleFunc("GET /readyz", readiness.Handler)
 
 	mux.HandleFunc("POST /api/users", conf.CreateUserHandler)
 	mux.HandleFunc("PUT /api/users", conf.UpdateUserHandler)
 	mux.HandleFunc("POST /api/login", conf.LoginUserHandler)
 	mux.HandleFunc("POST /api/refresh", conf.RefreshHandler)
 	mux.HandleFunc("POST /api/revoke", conf.RevokeHandler)
+	mux.HandleFunc("DELETE /api/users/me", conf.DeleteAccountHandler)
+	mux.HandleFunc("POST /api/users/me/restore", conf.RestoreAccountHandler)
+	mux.HandleFunc("GET /api/users/me/export", conf.ExportDataHandler)
+	mux.HandleFunc("GET /api/users/me/export/download", conf.DownloadExportHandler)
+	mux.HandleFunc("PUT /api/users/me/profile", conf.UpdateProfileHandler)
+	mux.HandleFunc("GET /api/users/me/warnings", conf.ShowWarningsHandler)
+	mux.HandleFunc("GET /api/users/{username}", conf.ShowProfileHandler)
+	mux.HandleFunc("GET /api/users/{user_id}/mentions", conf.ShowMentionsHandler)
+	mux.HandleFunc("POST /api/users/{user_id}/block", conf.BlockUserHandler)
+	mux.HandleFunc("DELETE /api/users/{user_id}/block", conf.UnblockUserHandler)
+	mux.HandleFunc("GET /api/blocks", conf.ShowBlocksHandler)
+	mux.HandleFunc("POST /api/users/{user_id}/mute", conf.MuteUserHandler)
+	mux.HandleFunc("DELETE /api/users/{user_id}/mute", conf.UnmuteUserHandler)
+	mux.HandleFunc("GET /api/mutes", conf.ShowMutesHandler)
 
 	mux.HandleFunc("GET /api/chirps", conf.ShowChirpsHandler)
 	mux.HandleFunc("GET /api/chirps/{chirp_id}", conf.ShowChirpHandler)
 	mux.HandleFunc("POST /api/chirps", conf.CreateChirpsHandler)
+	mux.HandleFunc("PUT /api/chirps/{chirp_id}", conf.UpdateChirpHandler)
 	mux.HandleFunc("DELETE /api/chirps/{chirp_id}", conf.DeleteChirpHandler)
+	mux.HandleFunc("POST /api/chirps/{chirp_id}/report", conf.ReportChirpHandler)
+	mux.HandleFunc("GET /api/chirps/scheduled", conf.ShowScheduledChirpsHandler)
+	mux.HandleFunc("PUT /api/chirps/scheduled/{chirp_id}", conf.UpdateScheduledChirpHandler)
+	mux.HandleFunc("DELETE /api/chirps/scheduled/{chirp_id}", conf.CancelScheduledChirpHandler)
+	mux.HandleFunc("GET /api/tags/{tag}", conf.ShowHashtagChirpsHandler)
+
+	mux.HandleFunc("POST /api/media", conf.UploadMediaHandler)
+	mux.HandleFunc("GET /api/media/{media_id}", conf.ShowMediaHandler)
+
+	mux.HandleFunc("POST /api/drafts", conf.CreateDraftHandler)
+	mux.HandleFunc("GET /api/drafts", conf.ShowDraftsHandler)
+	mux.HandleFunc("GET /api/drafts/{draft_id}", conf.ShowDraftHandler)
+	mux.HandleFunc("PUT /api/drafts/{draft_id}", conf.UpdateDraftHandler)
+	mux.HandleFunc("DELETE /api/drafts/{draft_id}", conf.DeleteDraftHandler)
+	mux.HandleFunc("POST /api/drafts/{draft_id}/publish", conf.PublishDraftHandler)
+
+	mux.HandleFunc("POST /api/conversations", conf.CreateConversationHandler)
+	mux.HandleFunc("GET /api/conversations", conf.ShowConversationsHandler)
+	mux.HandleFunc("GET /api/conversations/{conversation_id}", conf.ShowConversationHandler)
+	mux.HandleFunc("POST /api/conversations/{conversation_id}/messages", conf.SendMessageHandler)
+	mux.HandleFunc("GET /api/conversations/{conversation_id}/messages", conf.ShowMessagesHandler)
+	mux.HandleFunc("POST /api/conversations/{conversation_id}/read", conf.ReadConversationHandler)
+
+	mux.HandleFunc("GET /api/notifications", conf.ShowNotificationsHandler)
+	mux.HandleFunc("GET /api/notifications/unread_count", conf.UnreadNotificationsCountHandler)
+	mux.HandleFunc("POST /api/notifications/read", conf.ReadAllNotificationsHandler)
+	mux.HandleFunc("POST /api/notifications/{notification_id}/read", conf.ReadNotificationHandler)
 
 	mux.HandleFunc("POST /api/polka/webhooks", conf.PolkaWebhookHandler)
 
+	mux.HandleFunc("POST /api/webhooks", conf.CreateWebhookHandler)
+	mux.HandleFunc("GET /api/webhooks", conf.ShowWebhooksHandler)
+	mux.HandleFunc("DELETE /api/webhooks/{webhook_id}", conf.DeleteWebhookHandler)
+	mux.HandleFunc("GET /api/webhooks/{webhook_id}/deliveries", conf.ShowWebhookDeliveriesHandler)
+	mux.HandleFunc("POST /api/webhooks/{webhook_id}/deliveries/{delivery_id}/retry", conf.RetryWebhookDeliveryHandler)
+
+	mux.HandleFunc("GET /api/stream", conf.StreamHandler)
+	mux.HandleFunc("GET /api/stream/ws", conf.StreamWebSocketHandler)
+
+	go jobs.Every(ctx, time.Minute, "expire chirpy red memberships", conf.ExpireRedMemberships)
+	go jobs.Every(ctx, 5*time.Second, "publish scheduled chirps", conf.PublishScheduledChirps)
+	go jobs.Every(ctx, 5*time.Second, "deliver webhooks", conf.DeliverWebhooks)
+	go jobs.Every(ctx, time.Second, "dispatch outbox", dispatcher.Dispatch)
+	go jobs.Every(ctx, time.Hour, "prune outbox", dispatcher.Prune)
+	go jobs.Every(ctx, time.Second, "process media", conf.ProcessMedia)
+	go jobs.Every(ctx, time.Hour, "prune unattached media", conf.PruneMedia)
+	go jobs.Every(ctx, 5*time.Second, "process data exports", conf.ProcessDataExports)
+	go jobs.Every(ctx, time.Hour, "prune data exports", conf.PruneDataExports)
+	go jobs.Every(ctx, time.Minute, "purge deleted accounts", conf.PurgeDeletedAccounts)
+	go jobs.Every(ctx, statsFlushInterval, "flush stats", conf.FlushStats)
+
+	go func() {
+		if err := outbox.NewListener(DBUrl, queries, bus).Run(ctx); err != nil {
+			slog.Error("event listener stopped", "error", err.Error())
+		}
+	}()
+
+	shutdownDone := make(chan struct{})
+
+	go func() {
+		defer close(shutdownDone)
+
+		<-ctx.Done()
+
+		slog.Info("draining before shutdown", "period", drainPeriod)
+		readiness.SetDraining()
+		time.Sleep(drainPeriod)
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+			slog.Error("unable to shut down server", "error", shutdownErr.Error())
+		}
+
+		if flushErr := conf.FlushStats(shutdownCtx); flushErr != nil {
+			slog.Error("unable to flush stats", "error", flushErr.Error())
+		}
+	}()
+
 	err = server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		<-shutdownDone
+	}
+
+	if shutdownErr := shutdownTracing(context.Background()); shutdownErr != nil {
+		slog.Error("unable to flush traces", "error", shutdownErr.Error())
+	}
+
 	if !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("failed to start server: %s", err.Error())
 	}
 }
+
+// openBlobStore picks the media storage from MEDIA_STORAGE. Besides the
+// public store, it opens a private one that is never served. The local store
+// comes with the handler that serves its processed images.
+func openBlobStore() (blobstore.BlobStore, blobstore.BlobStore, http.Handler, error) {
+	publicURL := os.Getenv("MEDIA_URL")
+
+	switch os.Getenv("MEDIA_STORAGE") {
+	case "", "local":
+		dir := cmp.Or(os.Getenv("MEDIA_DIR"), "./media")
+
+		store, err := blobstore.NewLocalStore(dir, cmp.Or(publicURL, "/media"))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		private, err := blobstore.NewLocalStore(cmp.Or(os.Getenv("MEDIA_PRIVATE_DIR"), "./media-private"), "")
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		return store, private, http.StripPrefix("/media/", store.Handler(domain.IsPublicMediaKey)), nil
+	case "s3":
+		config := blobstore.S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PublicURL: publicURL,
+		}
+
+		// Public buckets expose every object, so private blobs need a bucket
+		// of their own.
+		privateConfig := config
+		privateConfig.Bucket = os.Getenv("S3_PRIVATE_BUCKET")
+		privateConfig.PublicURL = ""
+
+		if privateConfig.Bucket == "" || privateConfig.Bucket == config.Bucket {
+			return nil, nil, nil, errors.New("S3_PRIVATE_BUCKET must name a bucket other than S3_BUCKET")
+		}
+
+		client := &http.Client{Timeout: 30 * time.Second}
+
+		return blobstore.NewS3Store(client, config), blobstore.NewS3Store(client, privateConfig), nil, nil
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown MEDIA_STORAGE %q", os.Getenv("MEDIA_STORAGE"))
+	}
+}
@@ -0,0 +1,26 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Every runs job each interval until ctx is cancelled. Failed runs are logged
+// and retried on the next tick.
+func Every(ctx context.Context, interval time.Duration, name string, job func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "background job failed", "job", name, "error", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+)
+
+// Bus is an in-process sink that hands every event to its subscribers.
+// Subscribers are called synchronously and must not block.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[int]func(Event)
+	next        int
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: map[int]func(Event){}}
+}
+
+// Subscribe registers handler and returns a function that unregisters it.
+func (b *Bus) Subscribe(handler func(Event)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.next
+	b.next++
+	b.subscribers[id] = handler
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.subscribers, id)
+	}
+}
+
+func (b *Bus) Publish(_ context.Context, _ *database.Queries, event Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, handler := range b.subscribers {
+		handler(event)
+	}
+
+	return nil
+}
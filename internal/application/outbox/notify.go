@@ -0,0 +1,148 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+)
+
+const (
+	// Channel is the Postgres channel events are broadcast on.
+	Channel = "chirpy_events"
+
+	// maxNotifyPayload stays below the 8000 bytes Postgres accepts in a
+	// NOTIFY payload.
+	maxNotifyPayload = 7900
+
+	listenerPingInterval = 90 * time.Second
+)
+
+// notification is the NOTIFY payload. Payload is left out when it would not
+// fit, and listeners then load the event from the outbox.
+type notification struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	UserID    uuid.UUID       `json:"user_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// NotifySink broadcasts events to every replica with Postgres NOTIFY. The
+// notification is sent when the transaction of q commits.
+type NotifySink struct{}
+
+func (NotifySink) Publish(ctx context.Context, q *database.Queries, event Event) error {
+	message := notification{
+		ID:        event.ID,
+		Type:      event.Type,
+		UserID:    event.UserID,
+		CreatedAt: event.CreatedAt,
+		Payload:   event.Payload,
+	}
+
+	raw, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	if len(raw) > maxNotifyPayload {
+		message.Payload = nil
+
+		if raw, err = json.Marshal(message); err != nil {
+			return err
+		}
+	}
+
+	return q.NotifyOutboxEvent(ctx, database.NotifyOutboxEventParams{
+		Channel: Channel,
+		Payload: string(raw),
+	})
+}
+
+// Listener receives the events broadcast by NotifySink on any replica and
+// publishes them to a local sink, usually a Bus.
+type Listener struct {
+	url     string
+	queries *database.Queries
+	sink    Sink
+}
+
+func NewListener(url string, queries *database.Queries, sink Sink) *Listener {
+	return &Listener{url: url, queries: queries, sink: sink}
+}
+
+// Run listens until ctx is cancelled. The connection is re-established
+// automatically; events broadcast while it is down are lost for this
+// replica, which is logged.
+func (l *Listener) Run(ctx context.Context) error {
+	listener := pq.NewListener(l.url, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventConnected:
+			slog.Info("listening for events", "channel", Channel)
+		case pq.ListenerEventDisconnected:
+			slog.Warn("event listener disconnected", "error", err.Error())
+		case pq.ListenerEventReconnected:
+			slog.Warn("event listener reconnected, events may have been missed")
+		case pq.ListenerEventConnectionAttemptFailed:
+			slog.Error("event listener unable to connect", "error", err.Error())
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(Channel); err != nil {
+		return err
+	}
+
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ping.C:
+			// A failed ping makes the listener notice a dead connection.
+			_ = listener.Ping()
+		case n := <-listener.Notify:
+			// nil is sent after a reconnect, which the callback has logged.
+			if n == nil {
+				continue
+			}
+
+			if err := l.handle(ctx, n.Extra); err != nil {
+				slog.ErrorContext(ctx, "unable to handle notification", "error", err.Error())
+			}
+		}
+	}
+}
+
+func (l *Listener) handle(ctx context.Context, raw string) error {
+	var message notification
+
+	if err := json.Unmarshal([]byte(raw), &message); err != nil {
+		return err
+	}
+
+	if message.Payload == nil {
+		row, err := l.queries.GetOutboxEvent(ctx, message.ID)
+		if err != nil {
+			return err
+		}
+
+		message.Payload = json.RawMessage(row.Payload)
+	}
+
+	return l.sink.Publish(ctx, l.queries, Event{
+		ID:        message.ID,
+		Type:      message.Type,
+		UserID:    message.UserID,
+		CreatedAt: message.CreatedAt,
+		Payload:   message.Payload,
+	})
+}
@@ -0,0 +1,206 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+)
+
+const (
+	batchSize = 100
+	retention = 7 * 24 * time.Hour
+)
+
+// Envelope is the serialized form of every event, as stored in the outbox
+// and handed to webhook subscribers.
+type Envelope struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Event is what sinks receive. UserID is the user the event is about.
+type Event struct {
+	ID        uuid.UUID
+	Type      string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	Payload   []byte
+}
+
+func (e Event) Envelope() (Envelope, error) {
+	var envelope Envelope
+
+	err := json.Unmarshal(e.Payload, &envelope)
+
+	return envelope, err
+}
+
+// Sink receives published events. When dispatched, q is bound to the
+// transaction recording that the sink handled the event, so sinks must make
+// their database writes through q for them to happen exactly once. Other side
+// effects happen at least once.
+type Sink interface {
+	Publish(ctx context.Context, q *database.Queries, event Event) error
+}
+
+type SinkFunc func(ctx context.Context, q *database.Queries, event Event) error
+
+func (f SinkFunc) Publish(ctx context.Context, q *database.Queries, event Event) error {
+	return f(ctx, q, event)
+}
+
+// LogSink logs every event.
+type LogSink struct{}
+
+func (LogSink) Publish(ctx context.Context, _ *database.Queries, event Event) error {
+	slog.InfoContext(ctx, "event published",
+		"event_id", event.ID.String(),
+		"event", event.Type,
+		"subject_id", event.UserID.String(),
+	)
+
+	return nil
+}
+
+// Write stores the event in the outbox. q is expected to be bound to the
+// transaction that makes the change the event describes, so the event is
+// recorded if and only if the change is committed.
+func Write(ctx context.Context, q *database.Queries, eventType string, userID uuid.UUID, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	envelope := Envelope{
+		ID:        uuid.New(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      raw,
+	}
+
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	return q.InsertOutboxEvent(ctx, database.InsertOutboxEventParams{
+		ID:        envelope.ID,
+		CreatedAt: envelope.CreatedAt,
+		EventType: eventType,
+		UserID:    userID,
+		Payload:   string(payload),
+	})
+}
+
+// Dispatcher publishes committed outbox events to sinks.
+type Dispatcher struct {
+	transactor *database.Transactor
+	routes     []route
+}
+
+type route struct {
+	name string
+	sink Sink
+}
+
+func NewDispatcher(transactor *database.Transactor) *Dispatcher {
+	return &Dispatcher{transactor: transactor}
+}
+
+// Register adds a sink. name records which sinks handled an event, so it must
+// be unique and stay the same across releases.
+func (d *Dispatcher) Register(name string, sink Sink) {
+	d.routes = append(d.routes, route{name: name, sink: sink})
+}
+
+// Dispatch publishes a batch of pending events. Rows are locked while they
+// are published, so several replicas can dispatch concurrently; the lock is
+// FOR NO KEY UPDATE so that the delivery records of the sink transactions
+// can still reference them. An event that a sink rejects is retried later,
+// after a growing delay, and only for the sinks that have not handled it yet.
+func (d *Dispatcher) Dispatch(ctx context.Context) error {
+	return d.transactor.InTx(ctx, func(q *database.Queries) error {
+		rows, err := q.ClaimOutboxEvents(ctx, batchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			event := Event{
+				ID:        row.ID,
+				Type:      row.EventType,
+				UserID:    row.UserID,
+				CreatedAt: row.CreatedAt,
+				Payload:   []byte(row.Payload),
+			}
+
+			if publishErr := d.publish(ctx, event); publishErr != nil {
+				slog.ErrorContext(ctx, "unable to publish event",
+					"event_id", event.ID.String(), "event", event.Type, "error", publishErr.Error())
+
+				err = q.MarkOutboxEventFailed(ctx, database.MarkOutboxEventFailedParams{
+					ID:        row.ID,
+					LastError: sql.NullString{String: publishErr.Error(), Valid: true},
+				})
+			} else {
+				err = q.MarkOutboxEventPublished(ctx, row.ID)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// publish hands event to every sink in a transaction of its own, which also
+// records the delivery so that a retry skips the sink.
+func (d *Dispatcher) publish(ctx context.Context, event Event) error {
+	var errs []error
+
+	for _, route := range d.routes {
+		err := d.transactor.InTx(ctx, func(q *database.Queries) error {
+			recorded, err := q.RecordOutboxDelivery(ctx, database.RecordOutboxDeliveryParams{
+				EventID: event.ID,
+				Sink:    route.name,
+			})
+			if err != nil {
+				return err
+			}
+
+			// An earlier attempt already delivered the event to this sink.
+			if recorded == 0 {
+				return nil
+			}
+
+			return route.sink.Publish(ctx, q, event)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", route.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Prune deletes events that were published longer than a week ago.
+func (d *Dispatcher) Prune(ctx context.Context) error {
+	return d.transactor.InTx(ctx, func(q *database.Queries) error {
+		return q.DeletePublishedOutboxEvents(ctx, sql.NullTime{
+			Time:  time.Now().Add(-retention),
+			Valid: true,
+		})
+	})
+}
@@ -0,0 +1,421 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"github.com/mashfeii/chirpy/internal/application/outbox"
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+	"github.com/mashfeii/chirpy/pkg/auth"
+)
+
+const (
+	ActionUnsuspendUser  = "unsuspend_user"
+	ActionDeactivateUser = "deactivate_user"
+	ActionReactivateUser = "reactivate_user"
+
+	DefaultAccountDeletionGrace = 30 * 24 * time.Hour
+
+	accountPurgeBatch = 20
+)
+
+// accountStateError is returned for users whose account is suspended or
+// deactivated, whatever their credentials.
+type accountStateError struct {
+	message string
+}
+
+func (e *accountStateError) Error() string {
+	return e.message
+}
+
+type Suspension struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uuid.UUID  `json:"user_id"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// suspensionExpiry returns the end of a suspension lasting days, which never
+// ends when days is nil.
+func suspensionExpiry(days *int) (sql.NullTime, error) {
+	if days == nil {
+		return sql.NullTime{}, nil
+	}
+
+	if *days <= 0 {
+		return sql.NullTime{}, errors.New("suspension_days must be positive")
+	}
+
+	return sql.NullTime{Time: time.Now().AddDate(0, 0, *days), Valid: true}, nil
+}
+
+// checkAccount fails with an *accountStateError when userID is deactivated,
+// deleted or under an active suspension.
+func (conf *APIConfig) checkAccount(ctx context.Context, userID uuid.UUID) error {
+	user, err := conf.Database.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.DeactivatedAt.Valid {
+		return &accountStateError{message: "account is deactivated"}
+	}
+
+	// Past the grace period the account is being purged and cannot be
+	// restored.
+	if user.DeletionScheduledAt.Valid && !user.DeletionScheduledAt.Time.After(time.Now()) {
+		return &accountStateError{message: "account is deleted"}
+	}
+
+	suspension, err := conf.Database.GetActiveSuspension(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !suspension.ExpiresAt.Valid {
+		return &accountStateError{message: "account is suspended: " + suspension.Reason}
+	}
+
+	return &accountStateError{message: fmt.Sprintf("account is suspended until %s: %s",
+		suspension.ExpiresAt.Time.Format(time.RFC3339), suspension.Reason)}
+}
+
+// writeStateChange announces that action changed the account state of
+// userID, so that every replica drops what it cached about the user.
+func writeStateChange(ctx context.Context, q *database.Queries, userID uuid.UUID, action string) error {
+	return outbox.Write(ctx, q, UserStateChangedEvent, userID, map[string]string{
+		"user_id": userID.String(),
+		"action":  action,
+	})
+}
+
+// moderatedUser reads the user_id path value of admin user routes.
+// Moderators cannot act on their own account.
+func (conf *APIConfig) moderatedUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	moderatorID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	userID, err := uuid.Parse(r.PathValue("user_id"))
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	if userID == moderatorID {
+		errorRespond(w, r, http.StatusBadRequest, "moderators cannot act on their own account")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	if _, err = conf.Database.GetUserByID(r.Context(), userID); err != nil {
+		errorRespond(w, r, http.StatusNotFound, err.Error())
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return moderatorID, userID, true
+}
+
+// SuspendUserHandler suspends a user outside of reports, for days or
+// indefinitely when days is omitted.
+func (conf *APIConfig) SuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	type parameter struct {
+		Reason string `json:"reason"`
+		Days   *int   `json:"days"`
+	}
+
+	moderatorID, userID, ok := conf.moderatedUser(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+
+	var params parameter
+
+	if err := decoder.Decode(&params); err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	reason := strings.TrimSpace(params.Reason)
+	if reason == "" {
+		errorRespond(w, r, http.StatusBadRequest, "a suspension needs a reason")
+		return
+	}
+
+	expiresAt, err := suspensionExpiry(params.Days)
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var suspension database.UserSuspension
+
+	err = conf.Transactor.InTx(r.Context(), func(q *database.Queries) error {
+		suspension, err = q.CreateUserSuspension(r.Context(), database.CreateUserSuspensionParams{
+			UserID:    userID,
+			Reason:    reason,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err = writeStateChange(r.Context(), q, userID, ActionSuspendUser); err != nil {
+			return err
+		}
+
+		return q.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+			ModeratorID:  moderatorID,
+			Action:       ActionSuspendUser,
+			TargetUserID: uuid.NullUUID{UUID: userID, Valid: true},
+			Note:         reason,
+		})
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusCreated, Suspension{
+		ID:        suspension.ID,
+		CreatedAt: suspension.CreatedAt,
+		UserID:    suspension.UserID,
+		Reason:    suspension.Reason,
+		ExpiresAt: lo.Ternary(suspension.ExpiresAt.Valid, &suspension.ExpiresAt.Time, nil),
+	})
+}
+
+// changeAccountState runs change, reporting conflictMessage when it affects
+// no row, and records action in the audit trail.
+func (conf *APIConfig) changeAccountState(w http.ResponseWriter, r *http.Request, action, conflictMessage string,
+	change func(q *database.Queries, userID uuid.UUID) (int64, error),
+) {
+	moderatorID, userID, ok := conf.moderatedUser(w, r)
+	if !ok {
+		return
+	}
+
+	note, err := decodeNote(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	errConflict := errors.New(conflictMessage)
+
+	err = conf.Transactor.InTx(r.Context(), func(q *database.Queries) error {
+		rows, err := change(q, userID)
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return errConflict
+		}
+
+		if err = writeStateChange(r.Context(), q, userID, action); err != nil {
+			return err
+		}
+
+		return q.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+			ModeratorID:  moderatorID,
+			Action:       action,
+			TargetUserID: uuid.NullUUID{UUID: userID, Valid: true},
+			Note:         note,
+		})
+	})
+	if errors.Is(err, errConflict) {
+		errorRespond(w, r, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusNoContent, nil)
+}
+
+// UnsuspendUserHandler lifts the active suspensions of a user.
+func (conf *APIConfig) UnsuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	conf.changeAccountState(w, r, ActionUnsuspendUser, "user is not suspended",
+		func(q *database.Queries, userID uuid.UUID) (int64, error) {
+			return q.LiftSuspensions(r.Context(), userID)
+		})
+}
+
+// DeactivateUserHandler disables an account until it is reactivated. The
+// chirps of deactivated users are hidden from everyone.
+func (conf *APIConfig) DeactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	conf.changeAccountState(w, r, ActionDeactivateUser, "user is already deactivated",
+		func(q *database.Queries, userID uuid.UUID) (int64, error) {
+			return q.DeactivateUser(r.Context(), userID)
+		})
+}
+
+func (conf *APIConfig) ReactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	conf.changeAccountState(w, r, ActionReactivateUser, "user is not deactivated",
+		func(q *database.Queries, userID uuid.UUID) (int64, error) {
+			return q.ReactivateUser(r.Context(), userID)
+		})
+}
+
+// DeleteAccountHandler schedules the deletion of the authenticated account
+// once AccountDeletionGrace has passed. The password is asked again so that
+// a stolen access token is not enough to delete an account.
+func (conf *APIConfig) DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	type parameter struct {
+		Password string `json:"password"`
+	}
+
+	type response struct {
+		DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+	}
+
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+
+	var params parameter
+
+	if err = decoder.Decode(&params); err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := conf.Database.GetUserByID(r.Context(), userID)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err = auth.CheckPasswordHash(params.Password, user.HashedPassword); err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, "incorrect password")
+		return
+	}
+
+	if user.DeletionScheduledAt.Valid {
+		successRespond(w, r, http.StatusAccepted, response{DeletionScheduledAt: user.DeletionScheduledAt.Time})
+		return
+	}
+
+	user, err = conf.Database.ScheduleUserDeletion(r.Context(), database.ScheduleUserDeletionParams{
+		ID:                  userID,
+		DeletionScheduledAt: sql.NullTime{Time: time.Now().Add(conf.AccountDeletionGrace), Valid: true},
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusAccepted, response{DeletionScheduledAt: user.DeletionScheduledAt.Time})
+}
+
+// RestoreAccountHandler cancels a pending deletion during the grace period.
+func (conf *APIConfig) RestoreAccountHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	rows, err := conf.Database.CancelUserDeletion(r.Context(), userID)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if rows == 0 {
+		errorRespond(w, r, http.StatusConflict, "account is not pending deletion")
+		return
+	}
+
+	successRespond(w, r, http.StatusNoContent, nil)
+}
+
+// PurgeDeletedAccounts deletes the accounts whose grace period has ended,
+// along with their media and exports. It is meant to be run periodically.
+func (conf *APIConfig) PurgeDeletedAccounts(ctx context.Context) error {
+	userIDs, err := conf.Database.GetUsersDueForDeletion(ctx, accountPurgeBatch)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, userID := range userIDs {
+		if err = conf.purgeAccount(ctx, userID); err != nil {
+			errs = append(errs, fmt.Errorf("purge user %s: %w", userID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// purgeAccount deletes the blobs of the user and then the user, which
+// cascades to their rows. Blob deletions are idempotent, so a failed purge is
+// retried as a whole on the next run. Accounts past their grace period can
+// no longer be restored or used, see checkAccount.
+func (conf *APIConfig) purgeAccount(ctx context.Context, userID uuid.UUID) error {
+	files, err := conf.Database.GetMediaFilesByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	variants, err := conf.mediaVariants(ctx, conf.Database, files)
+	if err != nil {
+		return err
+	}
+
+	exports, err := conf.Database.GetDataExportsByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err = conf.deleteMediaBlobs(ctx, file, variants[file.ID]); err != nil {
+			return err
+		}
+	}
+
+	for _, export := range exports {
+		if !export.StorageKey.Valid {
+			continue
+		}
+
+		if err = conf.PrivateBlobStore.Delete(ctx, export.StorageKey.String); err != nil {
+			return err
+		}
+	}
+
+	rows, err := conf.Database.DeleteUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if rows > 0 {
+		slog.InfoContext(ctx, "deleted account", "user_id", userID.String())
+	}
+
+	return nil
+}
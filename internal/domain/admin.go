@@ -0,0 +1,207 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+)
+
+const (
+	StatUsers          = "users"
+	StatChirps         = "chirps"
+	StatLogins         = "logins"
+	StatRedUpgrades    = "red_upgrades"
+	StatFileserverHits = "fileserver_hits"
+
+	defaultStatsDays = 30
+	maxStatsDays     = 365
+)
+
+type StatsPoint struct {
+	Day   string `json:"day"`
+	Count int64  `json:"count"`
+}
+
+type AdminStats struct {
+	Totals map[string]int64        `json:"totals"`
+	Series map[string][]StatsPoint `json:"series"`
+}
+
+var adminMetricsTemplate = template.Must(template.New("metrics").Parse(`
+    <html>
+      <body>
+        <h1>Welcome, Chirpy Admin</h1>
+        <h2>Totals</h2>
+        <table>
+          {{- range $metric, $total := .Totals }}
+          <tr><td>{{ $metric }}</td><td>{{ $total }}</td></tr>
+          {{- end }}
+        </table>
+        <h2>Daily</h2>
+        {{- range $metric, $points := .Series }}
+        <h3>{{ $metric }}</h3>
+        <table>
+          {{- range $points }}
+          <tr><td>{{ .Day }}</td><td>{{ .Count }}</td></tr>
+          {{- end }}
+        </table>
+        {{- end }}
+      </body>
+    </html>`))
+
+// StatBuffer aggregates statistics in memory so that hot paths do not write
+// the same daily_stats row on every request.
+type StatBuffer struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func NewStatBuffer() *StatBuffer {
+	return &StatBuffer{counts: make(map[string]int64)}
+}
+
+func (b *StatBuffer) add(metric string, count int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.counts[metric] += count
+}
+
+func (b *StatBuffer) take() map[string]int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	counts := b.counts
+	b.counts = make(map[string]int64)
+
+	return counts
+}
+
+// recordStat bumps today's counter of metric. The count is only buffered
+// until the next FlushStats.
+func (conf *APIConfig) recordStat(metric string) {
+	conf.Stats.add(metric, 1)
+}
+
+// FlushStats writes the buffered statistics. Counts that could not be
+// written are buffered again. It is meant to be run periodically and once
+// more on shutdown.
+func (conf *APIConfig) FlushStats(ctx context.Context) error {
+	var errs []error
+
+	for metric, count := range conf.Stats.take() {
+		err := conf.Database.AddStat(ctx, database.AddStatParams{Metric: metric, Count: count})
+		if err != nil {
+			conf.Stats.add(metric, count)
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// MiddlewareAdmin only lets requests of authenticated admins through.
+func (conf *APIConfig) MiddlewareAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := conf.authenticate(r)
+		if err != nil {
+			errorRespond(w, r, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		user, err := conf.Database.GetUserByID(r.Context(), userID)
+		if err != nil {
+			errorRespond(w, r, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		if !user.IsAdmin {
+			errorRespond(w, r, http.StatusForbidden, "admin access required")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (conf *APIConfig) adminStats(r *http.Request) (AdminStats, error) {
+	days := defaultStatsDays
+
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err == nil && parsed > 0 && parsed <= maxStatsDays {
+			days = parsed
+		}
+	}
+
+	stats := AdminStats{
+		Totals: map[string]int64{},
+		Series: map[string][]StatsPoint{},
+	}
+
+	totals, err := conf.Database.GetStatTotals(r.Context())
+	if err != nil {
+		return stats, err
+	}
+
+	for _, total := range totals {
+		stats.Totals[total.Metric] = total.Total
+	}
+
+	// Users and chirps can be deleted, so their totals come from the tables
+	// themselves rather than from the number of creations.
+	if stats.Totals[StatUsers], err = conf.Database.CountUsers(r.Context()); err != nil {
+		return stats, err
+	}
+
+	if stats.Totals[StatChirps], err = conf.Database.CountChirps(r.Context()); err != nil {
+		return stats, err
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -days+1)
+
+	series, err := conf.Database.GetStatsSince(r.Context(), since)
+	if err != nil {
+		return stats, err
+	}
+
+	for _, point := range series {
+		stats.Series[point.Metric] = append(stats.Series[point.Metric], StatsPoint{
+			Day:   point.Day.Format(time.DateOnly),
+			Count: point.Count,
+		})
+	}
+
+	return stats, nil
+}
+
+func (conf *APIConfig) AdminMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := conf.adminStats(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Add("Content-Type", "text/html")
+
+	if err := adminMetricsTemplate.Execute(w, stats); err != nil {
+		slog.ErrorContext(r.Context(), "unable to render metrics", "error", err.Error())
+	}
+}
+
+func (conf *APIConfig) AdminMetricsJSONHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := conf.adminStats(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, stats)
+}
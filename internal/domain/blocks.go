@@ -0,0 +1,161 @@
+package domain
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+)
+
+type Block struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Mute struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// blockTarget reads the user_id path value of block and mute routes, which
+// has to be another existing user.
+func (conf *APIConfig) blockTarget(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	targetID, err := uuid.Parse(r.PathValue("user_id"))
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	if targetID == userID {
+		errorRespond(w, r, http.StatusBadRequest, "users cannot block or mute themselves")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	if _, err = conf.Database.GetUserByID(r.Context(), targetID); err != nil {
+		errorRespond(w, r, http.StatusNotFound, err.Error())
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, targetID, true
+}
+
+// BlockUserHandler hides the chirps of each user from the other, and stops
+// the target user from messaging or mentioning the authenticated user.
+func (conf *APIConfig) BlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := conf.blockTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := conf.Database.CreateBlock(r.Context(), database.CreateBlockParams{
+		BlockerID: userID,
+		BlockedID: targetID,
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusNoContent, nil)
+}
+
+func (conf *APIConfig) UnblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := conf.blockTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := conf.Database.DeleteBlock(r.Context(), database.DeleteBlockParams{
+		BlockerID: userID,
+		BlockedID: targetID,
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusNoContent, nil)
+}
+
+func (conf *APIConfig) ShowBlocksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	blocks, err := conf.Database.GetBlocksByUser(r.Context(), userID)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, lo.Map(blocks, func(block database.UserBlock, _ int) Block {
+		return Block{UserID: block.BlockedID, CreatedAt: block.CreatedAt}
+	}))
+}
+
+// MuteUserHandler hides the chirps and notifications of the target user from
+// the authenticated user only, the target can still message them.
+func (conf *APIConfig) MuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := conf.blockTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := conf.Database.CreateMute(r.Context(), database.CreateMuteParams{
+		MuterID: userID,
+		MutedID: targetID,
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusNoContent, nil)
+}
+
+func (conf *APIConfig) UnmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := conf.blockTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := conf.Database.DeleteMute(r.Context(), database.DeleteMuteParams{
+		MuterID: userID,
+		MutedID: targetID,
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusNoContent, nil)
+}
+
+func (conf *APIConfig) ShowMutesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	mutes, err := conf.Database.GetMutesByUser(r.Context(), userID)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, lo.Map(mutes, func(mute database.UserMute, _ int) Mute {
+		return Mute{UserID: mute.MutedID, CreatedAt: mute.CreatedAt}
+	}))
+}
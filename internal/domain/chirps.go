@@ -1,15 +1,113 @@
 package domain
 
 import (
+	"context"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
 )
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID        uuid.UUID     `json:"id"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	Body      string        `json:"body"`
+	UserID    uuid.UUID     `json:"user_id"`
+	PublishAt *time.Time    `json:"publish_at,omitempty"`
+	Hidden    bool          `json:"hidden,omitempty"`
+	Media     []Media       `json:"media,omitempty"`
+	Entities  []ChirpEntity `json:"entities,omitempty"`
+}
+
+// chirpFromDB converts a database chirp without its media and entities.
+// PublishAt is only set while the chirp is scheduled. Hidden chirps are only
+// shown to their author and moderators.
+func chirpFromDB(chirp database.Chirp) Chirp {
+	converted := Chirp{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+		Hidden:    chirp.HiddenAt.Valid,
+	}
+
+	if !chirp.Published && chirp.PublishAt.Valid {
+		converted.PublishAt = &chirp.PublishAt.Time
+	}
+
+	return converted
+}
+
+// expandChirps converts chirps and fills in their attached media and
+// entities, read through q.
+func (conf *APIConfig) expandChirps(ctx context.Context, q *database.Queries, chirps []database.Chirp) ([]Chirp, error) {
+	converted := lo.Map(chirps, func(chirp database.Chirp, _ int) Chirp {
+		return chirpFromDB(chirp)
+	})
+
+	if len(chirps) == 0 {
+		return converted, nil
+	}
+
+	chirpIDs := lo.Map(chirps, func(chirp database.Chirp, _ int) uuid.UUID {
+		return chirp.ID
+	})
+
+	files, err := q.GetMediaFilesByChirps(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	variants, err := conf.mediaVariants(ctx, q, files)
+	if err != nil {
+		return nil, err
+	}
+
+	mentions, err := q.GetChirpMentionsByChirps(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	filesByChirp := lo.GroupBy(files, func(file database.MediaFile) uuid.UUID {
+		return file.ChirpID.UUID
+	})
+	mentionsByChirp := lo.GroupBy(mentions, func(mention database.ChirpMention) uuid.UUID {
+		return mention.ChirpID
+	})
+
+	for i := range converted {
+		for _, file := range filesByChirp[converted[i].ID] {
+			converted[i].Media = append(converted[i].Media, conf.mediaFromDB(file, variants[file.ID]))
+		}
+
+		converted[i].Entities = chirpEntities(converted[i].Body, mentionsByChirp[converted[i].ID])
+	}
+
+	return converted, nil
+}
+
+func (conf *APIConfig) expandChirp(ctx context.Context, chirp database.Chirp) (Chirp, error) {
+	converted, err := conf.expandChirps(ctx, conf.Database, []database.Chirp{chirp})
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	return converted[0], nil
+}
+
+// sortChirps orders chirps from the newest when order is desc. They come
+// from the database oldest first.
+func sortChirps(chirps []Chirp, order string) []Chirp {
+	if order == "desc" {
+		sort.Slice(chirps, func(i, j int) bool {
+			return chirps[i].CreatedAt.After(chirps[j].CreatedAt)
+		})
+	}
+
+	return chirps
 }
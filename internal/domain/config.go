@@ -3,45 +3,125 @@ package domain
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
-	"sort"
-	"sync/atomic"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/mashfeii/chirpy/internal/application/outbox"
 	"github.com/mashfeii/chirpy/internal/infrastructure/api"
 	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+	"github.com/mashfeii/chirpy/internal/infrastructure/logging"
+	"github.com/mashfeii/chirpy/internal/infrastructure/metrics"
+	"github.com/mashfeii/chirpy/internal/infrastructure/tracing"
 	"github.com/mashfeii/chirpy/pkg/auth"
-	stringshelpers "github.com/mashfeii/chirpy/pkg/strings_helpers"
+	"github.com/mashfeii/chirpy/pkg/blobstore"
+	"github.com/mashfeii/chirpy/pkg/fanout"
+	"github.com/mashfeii/chirpy/pkg/ratelimit"
+	"github.com/mashfeii/chirpy/pkg/signature"
+	"github.com/mashfeii/chirpy/pkg/ttlcache"
+	"github.com/mashfeii/chirpy/pkg/webhook"
 	"github.com/samber/lo"
 )
 
 const (
-	UpgradeEvent = "user.upgraded"
+	UpgradeEvent      = "user.upgraded"
+	DowngradeEvent    = "user.downgraded"
+	CancellationEvent = "subscription.cancelled"
+	ExpirationEvent   = "subscription.expired"
+	RefundEvent       = "subscription.refunded"
 )
 
 type APIConfig struct {
-	FileserverHits atomic.Int32
-	Database       *database.Queries
-	Platform       string
-	Secret         string
-	Polka          string
+	Metrics       *metrics.Metrics
+	Database      *database.Queries
+	Transactor    *database.Transactor
+	RateLimiter   ratelimit.Store
+	WebhookSender *webhook.Sender
+	StreamHub     *fanout.Hub[StreamMessage]
+	BlobStore     blobstore.BlobStore
+	// PrivateBlobStore keeps the blobs that must never be served, like
+	// unprocessed uploads.
+	PrivateBlobStore     blobstore.BlobStore
+	MaxMediaBytes        int64
+	MediaWorkers         int
+	AccountDeletionGrace time.Duration
+	RateLimits           map[string]ratelimit.Limit
+	TierCache            *ttlcache.Cache[uuid.UUID, Tier]
+	Stats                *StatBuffer
+	Platform             string
+	Secret               string
+	Polka                string
 }
 
-func errorRespond(w http.ResponseWriter, code int, message string) {
+func errorRespond(w http.ResponseWriter, r *http.Request, code int, message string) {
+	_, span := tracing.Tracer().Start(r.Context(), "encode error response")
+	defer span.End()
+
+	if code >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "request failed", "status", code, "error", message)
+	}
+
 	if respondErr := api.RespondWithError(w, code, message); respondErr != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("unable to respond: %s", respondErr.Error())
+		slog.ErrorContext(r.Context(), "unable to respond", "error", respondErr.Error())
 	}
 }
 
-func successRespond(w http.ResponseWriter, code int, data interface{}) {
+func successRespond(w http.ResponseWriter, r *http.Request, code int, data interface{}) {
+	_, span := tracing.Tracer().Start(r.Context(), "encode response")
+	defer span.End()
+
 	if respondErr := api.RespondWithJSON(w, code, data); respondErr != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("unable to respond: %s", respondErr.Error())
+		slog.ErrorContext(r.Context(), "unable to respond", "error", respondErr.Error())
+	}
+}
+
+// authenticate validates the bearer JWT of the request and returns the user
+// it was issued for.
+func (conf *APIConfig) authenticate(r *http.Request) (uuid.UUID, error) {
+	_, span := tracing.Tracer().Start(r.Context(), "authenticate")
+	defer span.End()
+
+	token, err := auth.GetAuthorizationToken(r.Header, "Bearer")
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	userID, err := auth.ValidateJWT(token, conf.Secret)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// Tokens stay valid for an hour, so the account is checked on every
+	// request for suspensions and deactivations to apply right away.
+	if err = conf.checkAccount(r.Context(), userID); err != nil {
+		return uuid.Nil, err
 	}
+
+	logging.SetUserID(r.Context(), userID)
+
+	return userID, nil
+}
+
+// viewer returns the authenticated user for endpoints that also serve
+// anonymous requests, and uuid.Nil when there is no valid token.
+func (conf *APIConfig) viewer(r *http.Request) uuid.UUID {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.Nil
+	}
+
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		return uuid.Nil
+	}
+
+	return userID
 }
 
 func (conf *APIConfig) MiddlewareInc(next http.Handler) http.Handler {
@@ -50,43 +130,28 @@ func (conf *APIConfig) MiddlewareInc(next http.Handler) http.Handler {
 	// return next
 	// NOTE: instead, we need to return a new function
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		conf.FileserverHits.Add(1)
+		conf.Metrics.FileserverHits.Inc()
+		conf.recordStat(StatFileserverHits)
 		next.ServeHTTP(w, r)
 	})
 }
 
-func (conf *APIConfig) HitsHandler(r http.ResponseWriter, _ *http.Request) {
-	r.Header().Add("Content-Type", "text/html")
-
-	answer := fmt.Sprintf(`
-    <html>
-      <body>
-        <h1>Welcome, Chirpy Admin</h1>
-        <p>Chirpy has been visited %d times!</p>
-      </body>
-    </html>`,
-		conf.FileserverHits.Load())
-
-	_, err := r.Write([]byte(answer))
-	if err != nil {
-		panic(err)
-	}
-}
-
 func (conf *APIConfig) ResetHandler(w http.ResponseWriter, r *http.Request) {
 	if conf.Platform != "dev" {
 		w.WriteHeader(403)
 		return
 	}
 
-	prevValue := conf.FileserverHits.Load()
-	conf.FileserverHits.Store(0)
-
 	err := conf.Database.DeleteUsers(r.Context())
 	if err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 
-		conf.FileserverHits.Store(prevValue)
+		return
+	}
+
+	err = conf.Database.DeleteStats(r.Context())
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 
 		return
 	}
@@ -96,6 +161,7 @@ func (conf *APIConfig) CreateUserHandler(w http.ResponseWriter, r *http.Request)
 	type parameters struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Username string `json:"username"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -104,53 +170,75 @@ func (conf *APIConfig) CreateUserHandler(w http.ResponseWriter, r *http.Request)
 
 	err := decoder.Decode(&params)
 	if err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	username, err := parseUsername(params.Username)
 	if err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
 
 		return
 	}
 
-	user, err := conf.Database.CreateUser(r.Context(), database.CreateUserParams{
-		Email:          params.Email,
-		HashedPassword: hashedPassword,
-	})
+	hashedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 
 		return
 	}
 
-	successRespond(w, http.StatusCreated, User{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
+	var response User
+
+	err = conf.Transactor.InTx(r.Context(), func(q *database.Queries) error {
+		user, err := q.CreateUser(r.Context(), database.CreateUserParams{
+			Email:          params.Email,
+			HashedPassword: hashedPassword,
+			Username:       username,
+		})
+		if err != nil {
+			return err
+		}
+
+		response = User{
+			ID:          user.ID,
+			CreatedAt:   user.CreatedAt,
+			UpdatedAt:   user.UpdatedAt,
+			Email:       user.Email,
+			Username:    user.Username.String,
+			IsChirpyRed: user.IsChirpyRed,
+		}
+
+		return outbox.Write(r.Context(), q, UserCreatedEvent, user.ID, eventProfile(user))
 	})
-}
+	if isUniqueViolation(err) {
+		errorRespond(w, r, http.StatusConflict, "email or username is already taken")
+
+		return
+	} else if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 
-func (conf *APIConfig) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetAuthorizationToken(r.Header, "Bearer")
-	if err != nil {
-		errorRespond(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, conf.Secret)
+	conf.recordStat(StatUsers)
+
+	successRespond(w, r, http.StatusCreated, response)
+}
+
+func (conf *APIConfig) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticate(r)
 	if err != nil {
-		errorRespond(w, http.StatusUnauthorized, err.Error())
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
 		return
 	}
 
 	type parameters struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		// Username is left unchanged when empty.
+		Username string `json:"username"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -159,31 +247,51 @@ func (conf *APIConfig) UpdateUserHandler(w http.ResponseWriter, r *http.Request)
 
 	err = decoder.Decode(&params)
 	if err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	username, err := parseUsername(params.Username)
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	hashedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	newUser, err := conf.Database.UpdateUser(r.Context(), database.UpdateUserParams{
-		ID:             userID,
-		Email:          params.Email,
-		HashedPassword: hashedPassword,
+	var newUser database.User
+
+	err = conf.Transactor.InTx(r.Context(), func(q *database.Queries) error {
+		newUser, err = q.UpdateUser(r.Context(), database.UpdateUserParams{
+			ID:             userID,
+			Email:          params.Email,
+			HashedPassword: hashedPassword,
+			Username:       username,
+		})
+		if err != nil {
+			return err
+		}
+
+		return outbox.Write(r.Context(), q, UserUpdatedEvent, userID, eventProfile(newUser))
 	})
-	if err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+	if isUniqueViolation(err) {
+		errorRespond(w, r, http.StatusConflict, "email or username is already taken")
+		return
+	} else if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	successRespond(w, http.StatusOK, User{
+	successRespond(w, r, http.StatusOK, User{
 		ID:          newUser.ID,
 		CreatedAt:   newUser.CreatedAt,
 		UpdatedAt:   newUser.UpdatedAt,
 		Email:       newUser.Email,
+		Username:    newUser.Username.String,
 		IsChirpyRed: newUser.IsChirpyRed,
 	})
 }
@@ -200,31 +308,48 @@ func (conf *APIConfig) LoginUserHandler(w http.ResponseWriter, r *http.Request)
 
 	err := decoder.Decode(&params)
 	if err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 
 		return
 	}
 
 	user, err := conf.Database.GetUserByEmail(r.Context(), params.Email)
 	if err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+		conf.Metrics.LoginFailures.Inc()
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 
 		return
 	}
 
 	if err := auth.CheckPasswordHash(params.Password, user.HashedPassword); err != nil {
-		errorRespond(w, http.StatusUnauthorized, "incorrect email or password")
+		conf.Metrics.LoginFailures.Inc()
+		errorRespond(w, r, http.StatusUnauthorized, "incorrect email or password")
+
+		return
+	}
+
+	var stateErr *accountStateError
+
+	err = conf.checkAccount(r.Context(), user.ID)
+	if errors.As(err, &stateErr) {
+		errorRespond(w, r, http.StatusForbidden, err.Error())
+
+		return
+	} else if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 
 		return
 	}
 
 	token, err := auth.MakeJWT(user.ID, conf.Secret, time.Hour)
 	if err != nil {
-		errorRespond(w, http.StatusUnauthorized, err.Error())
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
 
 		return
 	}
 
+	conf.recordStat(StatLogins)
+
 	refreshToken := auth.MakeRefreshToken()
 
 	_, err = conf.Database.InsertRefreshToken(r.Context(), database.InsertRefreshTokenParams{
@@ -237,14 +362,15 @@ func (conf *APIConfig) LoginUserHandler(w http.ResponseWriter, r *http.Request)
 		UserID: user.ID,
 	})
 	if err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 	}
 
-	successRespond(w, http.StatusOK, User{
+	successRespond(w, r, http.StatusOK, User{
 		ID:           user.ID,
 		CreatedAt:    user.CreatedAt,
 		UpdatedAt:    user.UpdatedAt,
 		Email:        user.Email,
+		Username:     user.Username.String,
 		Token:        token,
 		RefreshToken: refreshToken,
 		IsChirpyRed:  user.IsChirpyRed,
@@ -253,7 +379,9 @@ func (conf *APIConfig) LoginUserHandler(w http.ResponseWriter, r *http.Request)
 
 func (conf *APIConfig) CreateChirpsHandler(w http.ResponseWriter, r *http.Request) {
 	type parameter struct {
-		Body string `json:"body"`
+		Body      string      `json:"body"`
+		PublishAt *time.Time  `json:"publish_at"`
+		MediaIDs  []uuid.UUID `json:"media_ids"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -262,41 +390,108 @@ func (conf *APIConfig) CreateChirpsHandler(w http.ResponseWriter, r *http.Reques
 
 	err := decoder.Decode(&params)
 	if err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	token, err := auth.GetAuthorizationToken(r.Header, "Bearer")
+	userID, err := conf.authenticate(r)
 	if err != nil {
-		errorRespond(w, http.StatusUnauthorized, err.Error())
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, conf.Secret)
+	entitlements, err := conf.entitlements(r.Context(), userID)
 	if err != nil {
-		errorRespond(w, http.StatusUnauthorized, err.Error())
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	if len(params.Body) > 140 {
-		errorRespond(w, 400, "Chirp is too long")
+	cleanedBody, err := cleanChirpBody(params.Body, entitlements)
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	cleanedBody := stringshelpers.CleanString(params.Body, []string{
-		"kerfuffle", "sharbert", "fornax",
-	})
+	publishAt, err := validatePublishAt(params.PublishAt, time.Now())
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	chirp, err := conf.Database.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   cleanedBody,
-		UserID: userID,
+	if len(params.MediaIDs) > maxChirpMedia {
+		errorRespond(w, r, http.StatusBadRequest, fmt.Sprintf("a chirp can have at most %d media", maxChirpMedia))
+		return
+	}
+
+	scheduled := publishAt.Valid
+
+	if scheduled && !entitlements.ScheduleChirps {
+		errorRespond(w, r, http.StatusForbidden, "scheduling chirps requires Chirpy Red")
+		return
+	}
+
+	var response Chirp
+
+	err = conf.Transactor.InTx(r.Context(), func(q *database.Queries) error {
+		chirp, err := q.CreateChirp(r.Context(), database.CreateChirpParams{
+			Body:      cleanedBody,
+			UserID:    userID,
+			PublishAt: publishAt,
+			Published: !scheduled,
+		})
+		if err != nil {
+			return err
+		}
+
+		files, err := attachMedia(r.Context(), q, chirp.ID, userID, params.MediaIDs)
+		if err != nil {
+			return err
+		}
+
+		mentions, err := saveChirpEntities(r.Context(), q, chirp)
+		if err != nil {
+			return err
+		}
+
+		response = chirpFromDB(chirp)
+		response.Entities = chirpEntities(chirp.Body, mentions)
+
+		if len(files) > 0 {
+			variants, err := q.GetMediaVariantsByFiles(r.Context(), params.MediaIDs)
+			if err != nil {
+				return err
+			}
+
+			byFile := lo.GroupBy(variants, func(variant database.MediaVariant) uuid.UUID {
+				return variant.MediaFileID
+			})
+
+			response.Media = lo.Map(files, func(file database.MediaFile, _ int) Media {
+				return conf.mediaFromDB(file, byFile[file.ID])
+			})
+		}
+
+		if scheduled {
+			return nil
+		}
+
+		return outbox.Write(r.Context(), q, ChirpCreatedEvent, userID, response)
 	})
-	if err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+	if errors.Is(err, errUnknownMedia) {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	successRespond(w, http.StatusCreated, Chirp(chirp))
+	// Scheduled chirps are counted when they are published.
+	if !scheduled {
+		conf.Metrics.ChirpsCreated.Inc()
+		conf.recordStat(StatChirps)
+	}
+
+	successRespond(w, r, http.StatusCreated, response)
 }
 
 func (conf *APIConfig) ShowChirpsHandler(w http.ResponseWriter, r *http.Request) {
@@ -304,89 +499,210 @@ func (conf *APIConfig) ShowChirpsHandler(w http.ResponseWriter, r *http.Request)
 
 	authorID, err := uuid.Parse(r.URL.Query().Get("author_id"))
 	if err != nil && !uuid.IsInvalidLengthError(err) {
-		errorRespond(w, http.StatusBadRequest, err.Error())
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	var chirps []database.Chirp
 
+	viewerID := conf.viewer(r)
+
 	switch authorID {
 	case uuid.UUID{}:
-		chirps, err = conf.Database.GetChirps(r.Context())
+		chirps, err = conf.Database.GetChirps(r.Context(), viewerID)
 	default:
-		chirps, err = conf.Database.GetChirpsByUser(r.Context(), authorID)
+		chirps, err = conf.Database.GetChirpsByUser(r.Context(), database.GetChirpsByUserParams{
+			UserID:   authorID,
+			ViewerID: viewerID,
+		})
 	}
 
 	if err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	convertedChirps := lo.Map(chirps, func(chirp database.Chirp, _ int) Chirp {
-		return Chirp(chirp)
-	})
-
-	if sortOrder == "desc" {
-		sort.Slice(convertedChirps, func(i, j int) bool {
-			return convertedChirps[i].CreatedAt.After(convertedChirps[j].CreatedAt)
-		})
+	convertedChirps, err := conf.expandChirps(r.Context(), conf.Database, chirps)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
 	}
 
-	successRespond(w, http.StatusOK, convertedChirps)
+	successRespond(w, r, http.StatusOK, sortChirps(convertedChirps, sortOrder))
 }
 
 func (conf *APIConfig) ShowChirpHandler(w http.ResponseWriter, r *http.Request) {
 	pattern, err := uuid.Parse(r.PathValue("chirp_id"))
 	if err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	chirp, err := conf.Database.GetChirp(r.Context(), pattern)
 	if err != nil {
-		errorRespond(w, http.StatusNotFound, err.Error())
+		errorRespond(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	viewerID := conf.viewer(r)
+
+	if (!chirp.Published || chirp.HiddenAt.Valid) && chirp.UserID != viewerID {
+		errorRespond(w, r, http.StatusNotFound, sql.ErrNoRows.Error())
+		return
+	}
+
+	blocked, err := conf.Database.IsBlockedBetween(r.Context(), database.IsBlockedBetweenParams{
+		UserID:  viewerID,
+		OtherID: chirp.UserID,
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if blocked {
+		errorRespond(w, r, http.StatusNotFound, sql.ErrNoRows.Error())
+		return
+	}
+
+	author, err := conf.Database.GetUserByID(r.Context(), chirp.UserID)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if author.DeactivatedAt.Valid {
+		errorRespond(w, r, http.StatusNotFound, sql.ErrNoRows.Error())
+		return
+	}
+
+	response, err := conf.expandChirp(r.Context(), chirp)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	successRespond(w, http.StatusOK, Chirp(chirp))
+	successRespond(w, r, http.StatusOK, response)
 }
 
 func (conf *APIConfig) DeleteChirpHandler(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetAuthorizationToken(r.Header, "Bearer")
+	userID, err := conf.authenticate(r)
 	if err != nil {
-		errorRespond(w, http.StatusUnauthorized, err.Error())
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, conf.Secret)
+	chirpID, err := uuid.Parse(r.PathValue("chirp_id"))
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	chirp, err := conf.Database.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		errorRespond(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if chirp.UserID != userID {
+		errorRespond(w, r, http.StatusForbidden, "user does not own chirp")
+		return
+	}
+
+	err = conf.Transactor.InTx(r.Context(), func(q *database.Queries) error {
+		if err := q.DeleteChirp(r.Context(), chirpID); err != nil || !chirp.Published {
+			return err
+		}
+
+		return outbox.Write(r.Context(), q, ChirpDeletedEvent, userID, chirpFromDB(chirp))
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusNoContent, nil)
+}
+
+func (conf *APIConfig) UpdateChirpHandler(w http.ResponseWriter, r *http.Request) {
+	type parameter struct {
+		Body string `json:"body"`
+	}
+
+	userID, err := conf.authenticate(r)
 	if err != nil {
-		errorRespond(w, http.StatusUnauthorized, err.Error())
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
 		return
 	}
 
 	chirpID, err := uuid.Parse(r.PathValue("chirp_id"))
 	if err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+
+	var params parameter
+
+	if err = decoder.Decode(&params); err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entitlements, err := conf.entitlements(r.Context(), userID)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	if !entitlements.EditChirps {
+		errorRespond(w, r, http.StatusForbidden, "editing chirps requires Chirpy Red")
 		return
 	}
 
 	chirp, err := conf.Database.GetChirp(r.Context(), chirpID)
 	if err != nil {
-		errorRespond(w, http.StatusNotFound, err.Error())
+		errorRespond(w, r, http.StatusNotFound, err.Error())
 		return
 	}
 
 	if chirp.UserID != userID {
-		errorRespond(w, http.StatusForbidden, "user does not own chirp")
+		errorRespond(w, r, http.StatusForbidden, "user does not own chirp")
+		return
+	}
+
+	cleanedBody, err := cleanChirpBody(params.Body, entitlements)
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = conf.Transactor.InTx(r.Context(), func(q *database.Queries) error {
+		chirp, err = q.UpdateChirp(r.Context(), database.UpdateChirpParams{
+			ID:   chirpID,
+			Body: cleanedBody,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = saveChirpEntities(r.Context(), q, chirp)
+
+		return err
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	if err = conf.Database.DeleteChirp(r.Context(), chirpID); err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+	response, err := conf.expandChirp(r.Context(), chirp)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	successRespond(w, http.StatusNoContent, nil)
+	successRespond(w, r, http.StatusOK, response)
 }
 
 func (conf *APIConfig) RefreshHandler(w http.ResponseWriter, r *http.Request) {
@@ -396,26 +712,37 @@ func (conf *APIConfig) RefreshHandler(w http.ResponseWriter, r *http.Request) {
 
 	token, err := auth.GetAuthorizationToken(r.Header, "Bearer")
 	if err != nil {
-		errorRespond(w, http.StatusUnauthorized, err.Error())
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
 		return
 	}
 
 	DBToken, err := conf.Database.GetRefreshToken(r.Context(), token)
 	if err != nil {
-		errorRespond(w, http.StatusUnauthorized, err.Error())
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
 		return
 	} else if DBToken.RevokedAt.Valid {
-		errorRespond(w, http.StatusUnauthorized, "refresh token has been revoked")
+		errorRespond(w, r, http.StatusUnauthorized, "refresh token has been revoked")
+		return
+	}
+
+	var stateErr *accountStateError
+
+	err = conf.checkAccount(r.Context(), DBToken.UserID)
+	if errors.As(err, &stateErr) {
+		errorRespond(w, r, http.StatusForbidden, err.Error())
+		return
+	} else if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	refreshedToken, err := auth.MakeJWT(DBToken.UserID, conf.Secret, time.Hour)
 	if err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	successRespond(w, http.StatusOK, returnValue{
+	successRespond(w, r, http.StatusOK, returnValue{
 		Token: refreshedToken,
 	})
 }
@@ -423,62 +750,128 @@ func (conf *APIConfig) RefreshHandler(w http.ResponseWriter, r *http.Request) {
 func (conf *APIConfig) RevokeHandler(w http.ResponseWriter, r *http.Request) {
 	token, err := auth.GetAuthorizationToken(r.Header, "Bearer")
 	if err != nil {
-		errorRespond(w, http.StatusUnauthorized, err.Error())
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
 		return
 	}
 
 	if err = conf.Database.RevokeRefreshToken(r.Context(), token); err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	successRespond(w, http.StatusNoContent, nil)
+	successRespond(w, r, http.StatusNoContent, nil)
 }
 
 func (conf *APIConfig) PolkaWebhookHandler(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
+		ID    string `json:"id"`
 		Event string `json:"event"`
 		Data  struct {
-			UserID string `json:"user_id"`
+			UserID    string    `json:"user_id"`
+			PeriodEnd time.Time `json:"period_end"`
 		} `json:"data"`
 	}
 
-	token, err := auth.GetAuthorizationToken(r.Header, "ApiKey")
-	if err != nil || token != conf.Polka {
-		errorRespond(w, http.StatusUnauthorized, err.Error())
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
-
-	var params parameters
+	// Anyone can sign with an empty key, so nothing is accepted without one.
+	if conf.Polka == "" {
+		errorRespond(w, r, http.StatusUnauthorized, "polka webhooks are not configured")
+		return
+	}
 
-	err = decoder.Decode(&params)
+	err = signature.Verify(conf.Polka, r.Header.Get(PolkaSignatureHeader), payload, webhookTolerance, time.Now())
 	if err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	if params.Event != UpgradeEvent {
-		errorRespond(w, http.StatusNoContent, "")
+	var params parameters
+
+	if err = json.Unmarshal(payload, &params); err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	userID, err := uuid.Parse(params.Data.UserID)
-	if err != nil {
-		errorRespond(w, http.StatusNoContent, "")
+	if params.ID == "" {
+		errorRespond(w, r, http.StatusBadRequest, "event id is required")
 		return
 	}
 
-	if _, err = conf.Database.GetUserByID(r.Context(), userID); err != nil {
-		errorRespond(w, http.StatusNotFound, err.Error())
+	// The payload is kept for audit whatever happens next, even when it
+	// cannot be applied.
+	err = conf.Database.RecordWebhookEvent(r.Context(), database.RecordWebhookEventParams{
+		ID:        params.ID,
+		Source:    polkaSource,
+		EventType: params.Event,
+		Payload:   string(payload),
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	if _, err = conf.Database.UpgradeUserRedChirp(r.Context(), userID); err != nil {
-		errorRespond(w, http.StatusInternalServerError, err.Error())
-		return
+	userID, err := uuid.Parse(params.Data.UserID)
+	status := lo.Ternary(slices.Contains(polkaEvents, params.Event) && err == nil, webhookEventProcessed, webhookEventIgnored)
+
+	periodEnd := sql.NullTime{
+		Time:  params.Data.PeriodEnd,
+		Valid: !params.Data.PeriodEnd.IsZero(),
 	}
 
-	successRespond(w, http.StatusNoContent, nil)
+	err = conf.Transactor.InTx(r.Context(), func(q *database.Queries) error {
+		// Completing the event locks it, so concurrent redeliveries wait for
+		// this transaction and are then seen as duplicates.
+		rows, err := q.CompleteWebhookEvent(r.Context(), database.CompleteWebhookEventParams{
+			Source: polkaSource,
+			ID:     params.ID,
+			Status: status,
+		})
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return errDuplicateEvent
+		}
+
+		if status == webhookEventIgnored {
+			return nil
+		}
+
+		if _, err = q.GetUserByID(r.Context(), userID); err != nil {
+			return errors.Join(errUnknownUser, err)
+		}
+
+		return applyPolkaEvent(r.Context(), q, params.Event, userID, periodEnd)
+	})
+	if err != nil && !errors.Is(err, errDuplicateEvent) {
+		failErr := conf.Database.FailWebhookEvent(r.Context(), database.FailWebhookEventParams{
+			Source:    polkaSource,
+			ID:        params.ID,
+			LastError: sql.NullString{String: err.Error(), Valid: true},
+		})
+		if failErr != nil {
+			slog.ErrorContext(r.Context(), "unable to record webhook event outcome", "error", failErr.Error())
+		}
+	}
+
+	switch {
+	case errors.Is(err, errDuplicateEvent):
+		successRespond(w, r, http.StatusNoContent, nil)
+	case errors.Is(err, errUnknownUser):
+		errorRespond(w, r, http.StatusNotFound, err.Error())
+	case err != nil:
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+	default:
+		if status == webhookEventProcessed && params.Event == UpgradeEvent {
+			conf.recordStat(StatRedUpgrades)
+		}
+
+		successRespond(w, r, http.StatusNoContent, nil)
+	}
 }
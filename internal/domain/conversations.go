@@ -0,0 +1,402 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+)
+
+const (
+	// maxConversationParticipants includes the creator of the conversation.
+	maxConversationParticipants = 10
+	maxMessageLength            = 1000
+	defaultMessagesLimit        = 50
+	maxMessagesLimit            = 100
+)
+
+var errBlocked = errors.New("a participant does not accept messages from the user")
+
+type Participant struct {
+	UserID     uuid.UUID  `json:"user_id"`
+	JoinedAt   time.Time  `json:"joined_at"`
+	LastReadAt *time.Time `json:"last_read_at,omitempty"`
+}
+
+type Conversation struct {
+	ID           uuid.UUID     `json:"id"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+	IsGroup      bool          `json:"is_group"`
+	Participants []Participant `json:"participants"`
+}
+
+type Message struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	SenderID       uuid.UUID `json:"sender_id"`
+	Body           string    `json:"body"`
+}
+
+// directKey identifies the one-to-one conversation of two users, whichever
+// of them starts it.
+func directKey(a, b uuid.UUID) sql.NullString {
+	if b.String() < a.String() {
+		a, b = b, a
+	}
+
+	return sql.NullString{String: a.String() + ":" + b.String(), Valid: true}
+}
+
+// conversationsWithParticipants converts conversations and fills in their
+// participants.
+func (conf *APIConfig) conversationsWithParticipants(ctx context.Context, conversations []database.Conversation) ([]Conversation, error) {
+	converted := lo.Map(conversations, func(conversation database.Conversation, _ int) Conversation {
+		return Conversation{
+			ID:           conversation.ID,
+			CreatedAt:    conversation.CreatedAt,
+			UpdatedAt:    conversation.UpdatedAt,
+			IsGroup:      conversation.IsGroup,
+			Participants: []Participant{},
+		}
+	})
+
+	if len(conversations) == 0 {
+		return converted, nil
+	}
+
+	participants, err := conf.Database.GetConversationParticipants(ctx, lo.Map(conversations, func(conversation database.Conversation, _ int) uuid.UUID {
+		return conversation.ID
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	byConversation := lo.GroupBy(participants, func(participant database.ConversationParticipant) uuid.UUID {
+		return participant.ConversationID
+	})
+
+	for i := range converted {
+		for _, participant := range byConversation[converted[i].ID] {
+			converted[i].Participants = append(converted[i].Participants, Participant{
+				UserID:     participant.UserID,
+				JoinedAt:   participant.JoinedAt,
+				LastReadAt: lo.Ternary(participant.LastReadAt.Valid, &participant.LastReadAt.Time, nil),
+			})
+		}
+	}
+
+	return converted, nil
+}
+
+// participantConversation loads the conversation from the conversation_id
+// path value. Conversations the authenticated user does not take part in
+// are reported as missing.
+func (conf *APIConfig) participantConversation(w http.ResponseWriter, r *http.Request) (Conversation, uuid.UUID, bool) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return Conversation{}, uuid.Nil, false
+	}
+
+	conversationID, err := uuid.Parse(r.PathValue("conversation_id"))
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return Conversation{}, uuid.Nil, false
+	}
+
+	conversation, err := conf.Database.GetConversation(r.Context(), conversationID)
+	if err != nil {
+		errorRespond(w, r, http.StatusNotFound, err.Error())
+		return Conversation{}, uuid.Nil, false
+	}
+
+	converted, err := conf.conversationsWithParticipants(r.Context(), []database.Conversation{conversation})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return Conversation{}, uuid.Nil, false
+	}
+
+	if !lo.ContainsBy(converted[0].Participants, func(participant Participant) bool {
+		return participant.UserID == userID
+	}) {
+		errorRespond(w, r, http.StatusNotFound, sql.ErrNoRows.Error())
+		return Conversation{}, uuid.Nil, false
+	}
+
+	return converted[0], userID, true
+}
+
+// checkBlocked fails with errBlocked if one of recipients blocked senderID.
+func (conf *APIConfig) checkBlocked(ctx context.Context, senderID uuid.UUID, recipients []uuid.UUID) error {
+	count, err := conf.Database.CountBlockingUsers(ctx, database.CountBlockingUsersParams{
+		BlockedID:  senderID,
+		BlockerIds: recipients,
+	})
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return errBlocked
+	}
+
+	return nil
+}
+
+// CreateConversationHandler starts a conversation with the given users. A
+// one-to-one conversation is only created once, later calls return it.
+func (conf *APIConfig) CreateConversationHandler(w http.ResponseWriter, r *http.Request) {
+	type parameter struct {
+		ParticipantIDs []uuid.UUID `json:"participant_ids"`
+	}
+
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+
+	var params parameter
+
+	if err = decoder.Decode(&params); err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	others := lo.Without(lo.Uniq(params.ParticipantIDs), userID)
+
+	if len(others) == 0 || len(others) >= maxConversationParticipants {
+		errorRespond(w, r, http.StatusBadRequest,
+			fmt.Sprintf("a conversation needs 1 to %d other participants", maxConversationParticipants-1))
+
+		return
+	}
+
+	for _, other := range others {
+		if _, err = conf.Database.GetUserByID(r.Context(), other); err != nil {
+			errorRespond(w, r, http.StatusBadRequest, "participant "+other.String()+" does not exist")
+			return
+		}
+	}
+
+	err = conf.checkBlocked(r.Context(), userID, others)
+	if errors.Is(err, errBlocked) {
+		errorRespond(w, r, http.StatusForbidden, err.Error())
+		return
+	} else if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	isGroup := len(others) > 1
+	status := http.StatusCreated
+
+	var conversation database.Conversation
+
+	err = conf.Transactor.InTx(r.Context(), func(q *database.Queries) error {
+		params := database.CreateConversationParams{IsGroup: isGroup}
+		if !isGroup {
+			params.DirectKey = directKey(userID, others[0])
+		}
+
+		conversation, err = q.CreateConversation(r.Context(), params)
+		if errors.Is(err, sql.ErrNoRows) {
+			status = http.StatusOK
+			conversation, err = q.GetConversationByDirectKey(r.Context(), params.DirectKey)
+
+			return err
+		} else if err != nil {
+			return err
+		}
+
+		return q.AddConversationParticipants(r.Context(), database.AddConversationParticipantsParams{
+			ConversationID: conversation.ID,
+			UserIds:        append([]uuid.UUID{userID}, others...),
+		})
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	converted, err := conf.conversationsWithParticipants(r.Context(), []database.Conversation{conversation})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, status, converted[0])
+}
+
+func (conf *APIConfig) ShowConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	conversations, err := conf.Database.GetConversationsByUser(r.Context(), userID)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	converted, err := conf.conversationsWithParticipants(r.Context(), conversations)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, converted)
+}
+
+func (conf *APIConfig) ShowConversationHandler(w http.ResponseWriter, r *http.Request) {
+	conversation, _, ok := conf.participantConversation(w, r)
+	if !ok {
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, conversation)
+}
+
+func (conf *APIConfig) SendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	type parameter struct {
+		Body string `json:"body"`
+	}
+
+	conversation, userID, ok := conf.participantConversation(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+
+	var params parameter
+
+	if err := decoder.Decode(&params); err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	body := strings.TrimSpace(params.Body)
+
+	if body == "" || utf8.RuneCountInString(body) > maxMessageLength {
+		errorRespond(w, r, http.StatusBadRequest, fmt.Sprintf("message must be 1 to %d characters", maxMessageLength))
+		return
+	}
+
+	recipients := lo.FilterMap(conversation.Participants, func(participant Participant, _ int) (uuid.UUID, bool) {
+		return participant.UserID, participant.UserID != userID
+	})
+
+	err := conf.checkBlocked(r.Context(), userID, recipients)
+	if errors.Is(err, errBlocked) {
+		errorRespond(w, r, http.StatusForbidden, err.Error())
+		return
+	} else if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var message database.Message
+
+	err = conf.Transactor.InTx(r.Context(), func(q *database.Queries) error {
+		message, err = q.CreateMessage(r.Context(), database.CreateMessageParams{
+			ConversationID: conversation.ID,
+			SenderID:       userID,
+			Body:           body,
+		})
+		if err != nil {
+			return err
+		}
+
+		return q.TouchConversation(r.Context(), conversation.ID)
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusCreated, Message(message))
+}
+
+// ShowMessagesHandler lists messages newest first. Older pages are fetched
+// by passing the id of the last message as before.
+func (conf *APIConfig) ShowMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	conversation, _, ok := conf.participantConversation(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
+	params := database.GetMessagesParams{
+		ConversationID: conversation.ID,
+		Limit:          defaultMessagesLimit,
+	}
+
+	if raw := query.Get("before"); raw != "" {
+		before, err := uuid.Parse(raw)
+		if err != nil {
+			errorRespond(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		params.Before = uuid.NullUUID{UUID: before, Valid: true}
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > maxMessagesLimit {
+			errorRespond(w, r, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxMessagesLimit))
+			return
+		}
+
+		params.Limit = int32(limit)
+	}
+
+	messages, err := conf.Database.GetMessages(r.Context(), params)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, lo.Map(messages, func(message database.Message, _ int) Message {
+		return Message(message)
+	}))
+}
+
+// ReadConversationHandler records that the user has read the conversation
+// up to now. Other participants see it as their last_read_at.
+func (conf *APIConfig) ReadConversationHandler(w http.ResponseWriter, r *http.Request) {
+	conversation, userID, ok := conf.participantConversation(w, r)
+	if !ok {
+		return
+	}
+
+	err := conf.Database.MarkConversationRead(r.Context(), database.MarkConversationReadParams{
+		ConversationID: conversation.ID,
+		UserID:         userID,
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusNoContent, nil)
+}
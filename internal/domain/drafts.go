@@ -0,0 +1,238 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"github.com/mashfeii/chirpy/internal/application/outbox"
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+)
+
+var errDraftGone = errors.New("draft has already been published or deleted")
+
+type Draft struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Body      string    `json:"body"`
+	UserID    uuid.UUID `json:"user_id"`
+}
+
+// draftBody decodes the body parameter and validates it the same way as the
+// body of a chirp.
+func (conf *APIConfig) draftBody(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (string, bool) {
+	type parameter struct {
+		Body string `json:"body"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+
+	var params parameter
+
+	if err := decoder.Decode(&params); err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+
+	entitlements, err := conf.entitlements(r.Context(), userID)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return "", false
+	}
+
+	body, err := cleanChirpBody(params.Body, entitlements)
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+
+	return body, true
+}
+
+func (conf *APIConfig) CreateDraftHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	body, ok := conf.draftBody(w, r, userID)
+	if !ok {
+		return
+	}
+
+	draft, err := conf.Database.CreateDraft(r.Context(), database.CreateDraftParams{
+		Body:   body,
+		UserID: userID,
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusCreated, Draft(draft))
+}
+
+func (conf *APIConfig) ShowDraftsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	drafts, err := conf.Database.GetDraftsByUser(r.Context(), userID)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, lo.Map(drafts, func(draft database.Draft, _ int) Draft {
+		return Draft(draft)
+	}))
+}
+
+// ownedDraft loads the draft from the draft_id path value and checks that it
+// belongs to the authenticated user.
+func (conf *APIConfig) ownedDraft(w http.ResponseWriter, r *http.Request) (database.Draft, bool) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return database.Draft{}, false
+	}
+
+	draftID, err := uuid.Parse(r.PathValue("draft_id"))
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return database.Draft{}, false
+	}
+
+	draft, err := conf.Database.GetDraft(r.Context(), draftID)
+	if err != nil {
+		errorRespond(w, r, http.StatusNotFound, err.Error())
+		return database.Draft{}, false
+	}
+
+	if draft.UserID != userID {
+		errorRespond(w, r, http.StatusForbidden, "user does not own draft")
+		return database.Draft{}, false
+	}
+
+	return draft, true
+}
+
+func (conf *APIConfig) ShowDraftHandler(w http.ResponseWriter, r *http.Request) {
+	draft, ok := conf.ownedDraft(w, r)
+	if !ok {
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, Draft(draft))
+}
+
+func (conf *APIConfig) UpdateDraftHandler(w http.ResponseWriter, r *http.Request) {
+	draft, ok := conf.ownedDraft(w, r)
+	if !ok {
+		return
+	}
+
+	body, ok := conf.draftBody(w, r, draft.UserID)
+	if !ok {
+		return
+	}
+
+	draft, err := conf.Database.UpdateDraft(r.Context(), database.UpdateDraftParams{
+		ID:   draft.ID,
+		Body: body,
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, Draft(draft))
+}
+
+func (conf *APIConfig) DeleteDraftHandler(w http.ResponseWriter, r *http.Request) {
+	draft, ok := conf.ownedDraft(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := conf.Database.DeleteDraft(r.Context(), draft.ID); err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusNoContent, nil)
+}
+
+// PublishDraftHandler turns a draft into a chirp. The draft is removed in the
+// same transaction, so it is published at most once.
+func (conf *APIConfig) PublishDraftHandler(w http.ResponseWriter, r *http.Request) {
+	draft, ok := conf.ownedDraft(w, r)
+	if !ok {
+		return
+	}
+
+	// The tier may have changed since the draft was saved.
+	entitlements, err := conf.entitlements(r.Context(), draft.UserID)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	body, err := cleanChirpBody(draft.Body, entitlements)
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var response Chirp
+
+	err = conf.Transactor.InTx(r.Context(), func(q *database.Queries) error {
+		deleted, err := q.DeleteDraft(r.Context(), draft.ID)
+		if err != nil {
+			return err
+		}
+
+		if deleted == 0 {
+			return errDraftGone
+		}
+
+		chirp, err := q.CreateChirp(r.Context(), database.CreateChirpParams{
+			Body:      body,
+			UserID:    draft.UserID,
+			Published: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		mentions, err := saveChirpEntities(r.Context(), q, chirp)
+		if err != nil {
+			return err
+		}
+
+		response = chirpFromDB(chirp)
+		response.Entities = chirpEntities(chirp.Body, mentions)
+
+		return outbox.Write(r.Context(), q, ChirpCreatedEvent, draft.UserID, response)
+	})
+	if errors.Is(err, errDraftGone) {
+		errorRespond(w, r, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	conf.Metrics.ChirpsCreated.Inc()
+	conf.recordStat(StatChirps)
+
+	successRespond(w, r, http.StatusCreated, response)
+}
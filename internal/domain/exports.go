@@ -0,0 +1,315 @@
+package domain
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+)
+
+const (
+	// exportReady and exportFailed are final statuses of exports, the
+	// others being pending and processing.
+	exportReady  = "ready"
+	exportFailed = "failed"
+
+	exportDownloadPath = "/api/users/me/export/download"
+	exportTTL          = 7 * 24 * time.Hour
+	exportBatch        = 4
+	exportPruneBatch   = 100
+	// exportProcessingTimeout after which exports stuck in processing are
+	// claimed again.
+	exportProcessingTimeout = 10 * time.Minute
+)
+
+// DataExport is an archive of everything a user created. DownloadURL is only
+// set once the archive is ready.
+type DataExport struct {
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+type exportedProfile struct {
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Email       string     `json:"email"`
+	Username    string     `json:"username,omitempty"`
+	DisplayName string     `json:"display_name"`
+	Bio         string     `json:"bio"`
+	IsChirpyRed bool       `json:"is_chirpy_red"`
+	RedEndsAt   *time.Time `json:"red_ends_at,omitempty"`
+}
+
+// exportedSession describes a refresh token without the token itself.
+type exportedSession struct {
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+func dataExportFromDB(export database.DataExport) DataExport {
+	converted := DataExport{
+		ID:        export.ID,
+		CreatedAt: export.CreatedAt,
+		Status:    export.Status,
+		Error:     export.LastError.String,
+		ExpiresAt: lo.Ternary(export.ExpiresAt.Valid, &export.ExpiresAt.Time, nil),
+	}
+
+	if export.Status == exportReady {
+		converted.DownloadURL = exportDownloadPath
+	}
+
+	return converted
+}
+
+func exportExpired(export database.DataExport) bool {
+	return export.ExpiresAt.Valid && export.ExpiresAt.Time.Before(time.Now())
+}
+
+// ExportDataHandler returns the latest export of the user, requesting a new
+// one when there is none or the latest failed or expired.
+func (conf *APIConfig) ExportDataHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	export, err := conf.Database.GetLatestDataExport(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (export.Status == exportFailed || exportExpired(export))) {
+		export, err = conf.Database.CreateDataExport(r.Context(), userID)
+	}
+
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, lo.Ternary(export.Status == exportReady, http.StatusOK, http.StatusAccepted), dataExportFromDB(export))
+}
+
+// DownloadExportHandler serves the archive of the latest ready export.
+func (conf *APIConfig) DownloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	export, err := conf.Database.GetLatestDataExport(r.Context(), userID)
+	if err != nil || export.Status != exportReady || exportExpired(export) {
+		errorRespond(w, r, http.StatusNotFound, "no export is ready")
+		return
+	}
+
+	archive, err := conf.PrivateBlobStore.Get(r.Context(), export.StorageKey.String)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="chirpy-export.zip"`)
+	w.WriteHeader(http.StatusOK)
+
+	if _, err = w.Write(archive); err != nil {
+		slog.ErrorContext(r.Context(), "unable to respond", "error", err.Error())
+	}
+}
+
+// ProcessDataExports claims pending exports and builds their archives. It is
+// meant to be run periodically.
+func (conf *APIConfig) ProcessDataExports(ctx context.Context) error {
+	exports, err := conf.Database.ClaimPendingDataExports(ctx, database.ClaimPendingDataExportsParams{
+		StaleBefore: time.Now().Add(-exportProcessingTimeout),
+		Limit:       exportBatch,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		key := "exports/" + export.ID.String() + ".zip"
+
+		err = conf.writeDataExport(ctx, export.UserID, key)
+		if err != nil {
+			slog.WarnContext(ctx, "unable to export data", "export_id", export.ID.String(), "error", err.Error())
+
+			err = conf.Database.MarkDataExportFailed(ctx, database.MarkDataExportFailedParams{
+				ID:        export.ID,
+				LastError: sql.NullString{String: err.Error(), Valid: true},
+			})
+		} else {
+			err = conf.Database.MarkDataExportReady(ctx, database.MarkDataExportReadyParams{
+				ID:         export.ID,
+				StorageKey: sql.NullString{String: key, Valid: true},
+				ExpiresAt:  sql.NullTime{Time: time.Now().Add(exportTTL), Valid: true},
+			})
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeDataExport stores under key a zip archive of the JSON documents of
+// userID and the originals of their media. Archives go to the private store
+// and are only served by DownloadExportHandler.
+func (conf *APIConfig) writeDataExport(ctx context.Context, userID uuid.UUID, key string) error {
+	user, err := conf.Database.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	chirps, err := conf.Database.GetAllChirpsByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	expanded, err := conf.expandChirps(ctx, conf.Database, chirps)
+	if err != nil {
+		return err
+	}
+
+	drafts, err := conf.Database.GetDraftsByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	messages, err := conf.Database.GetMessagesBySender(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := conf.Database.GetRefreshTokensByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	files, err := conf.Database.GetMediaFilesByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	documents := map[string]any{
+		"profile.json": exportedProfile{
+			ID:          user.ID,
+			CreatedAt:   user.CreatedAt,
+			UpdatedAt:   user.UpdatedAt,
+			Email:       user.Email,
+			Username:    user.Username.String,
+			DisplayName: user.DisplayName,
+			Bio:         user.Bio,
+			IsChirpyRed: user.IsChirpyRed,
+			RedEndsAt:   lo.Ternary(user.RedEndsAt.Valid, &user.RedEndsAt.Time, nil),
+		},
+		"chirps.json": expanded,
+		"drafts.json": lo.Map(drafts, func(draft database.Draft, _ int) Draft {
+			return Draft(draft)
+		}),
+		"messages.json": lo.Map(messages, func(message database.Message, _ int) Message {
+			return Message(message)
+		}),
+		"sessions.json": lo.Map(tokens, func(token database.RefreshToken, _ int) exportedSession {
+			return exportedSession{
+				CreatedAt: token.CreatedAt,
+				ExpiresAt: token.ExpiresAt,
+				RevokedAt: lo.Ternary(token.RevokedAt.Valid, &token.RevokedAt.Time, nil),
+			}
+		}),
+		"media.json": lo.Map(files, func(file database.MediaFile, _ int) Media {
+			return conf.mediaFromDB(file, nil)
+		}),
+	}
+
+	var buf bytes.Buffer
+
+	archive := zip.NewWriter(&buf)
+
+	for name, document := range documents {
+		entry, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(entry)
+		encoder.SetIndent("", "  ")
+
+		if err = encoder.Encode(document); err != nil {
+			return err
+		}
+	}
+
+	for _, file := range files {
+		if file.Status != mediaReady {
+			continue
+		}
+
+		data, err := conf.BlobStore.Get(ctx, file.StorageKey)
+		if err != nil {
+			return err
+		}
+
+		entry, err := archive.Create("media/" + file.ID.String() + path.Ext(file.StorageKey))
+		if err != nil {
+			return err
+		}
+
+		if _, err = entry.Write(data); err != nil {
+			return err
+		}
+	}
+
+	if err = archive.Close(); err != nil {
+		return err
+	}
+
+	return conf.PrivateBlobStore.Put(ctx, key, "application/zip", buf.Bytes())
+}
+
+// PruneDataExports deletes expired exports and their archives. It is meant
+// to be run periodically.
+func (conf *APIConfig) PruneDataExports(ctx context.Context) error {
+	exports, err := conf.Database.GetExpiredDataExports(ctx, exportPruneBatch)
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if export.StorageKey.Valid {
+			if err = conf.PrivateBlobStore.Delete(ctx, export.StorageKey.String); err != nil {
+				return err
+			}
+		}
+
+		if err = conf.Database.DeleteDataExport(ctx, export.ID); err != nil {
+			return err
+		}
+	}
+
+	if len(exports) > 0 {
+		slog.InfoContext(ctx, "pruned expired data exports", "count", len(exports))
+	}
+
+	return nil
+}
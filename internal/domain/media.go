@@ -0,0 +1,455 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+	"github.com/mashfeii/chirpy/pkg/blobstore"
+	"github.com/mashfeii/chirpy/pkg/imageproc"
+)
+
+const (
+	DefaultMaxMediaBytes = 5 << 20
+
+	// mediaReady is the status of processed media, the others being
+	// pending, processing and failed.
+	mediaReady = "ready"
+
+	maxChirpMedia      = 4
+	mediaFormField     = "file"
+	unattachedMediaTTL = 24 * time.Hour
+	mediaPruneBatch    = 100
+	// mediaProcessingTimeout after which media stuck in processing, e.g.
+	// because a replica died, are claimed again.
+	mediaProcessingTimeout = 5 * time.Minute
+)
+
+var mediaProcessor = imageproc.Processor{
+	MaxPixels:   40_000_000,
+	JPEGQuality: 85,
+	Sizes: []imageproc.Size{
+		{Name: "small", MaxEdge: 150},
+		{Name: "medium", MaxEdge: 600},
+		{Name: "large", MaxEdge: 1600},
+	},
+}
+
+// publicMediaKey matches the keys of processed originals and thumbnails,
+// the only blobs that are served.
+var publicMediaKey = regexp.MustCompile(fmt.Sprintf(`^[0-9a-f-]{36}/(original|%s)\.(jpg|png)$`,
+	strings.Join(lo.Map(mediaProcessor.Sizes, func(size imageproc.Size, _ int) string {
+		return size.Name
+	}), "|")))
+
+var errUnknownMedia = errors.New("media do not exist, belong to someone else, are not ready or are already attached")
+
+type MediaVariant struct {
+	URL    string `json:"url"`
+	Width  int32  `json:"width"`
+	Height int32  `json:"height"`
+}
+
+// Media is an uploaded image. URL and Thumbnails are only set once the
+// image has been processed and Status is ready.
+type Media struct {
+	ID          uuid.UUID               `json:"id"`
+	CreatedAt   time.Time               `json:"created_at"`
+	Status      string                  `json:"status"`
+	Error       string                  `json:"error,omitempty"`
+	URL         string                  `json:"url,omitempty"`
+	ContentType string                  `json:"content_type"`
+	Size        int64                   `json:"size"`
+	Width       int32                   `json:"width"`
+	Height      int32                   `json:"height"`
+	Thumbnails  map[string]MediaVariant `json:"thumbnails,omitempty"`
+}
+
+func (conf *APIConfig) mediaFromDB(file database.MediaFile, variants []database.MediaVariant) Media {
+	media := Media{
+		ID:          file.ID,
+		CreatedAt:   file.CreatedAt,
+		Status:      file.Status,
+		Error:       file.LastError.String,
+		ContentType: file.ContentType,
+		Size:        file.SizeBytes,
+		Width:       file.Width,
+		Height:      file.Height,
+	}
+
+	if file.Status != mediaReady {
+		return media
+	}
+
+	media.URL = conf.BlobStore.URL(file.StorageKey)
+
+	for _, variant := range variants {
+		if media.Thumbnails == nil {
+			media.Thumbnails = map[string]MediaVariant{}
+		}
+
+		media.Thumbnails[variant.Name] = MediaVariant{
+			URL:    conf.BlobStore.URL(variant.StorageKey),
+			Width:  variant.Width,
+			Height: variant.Height,
+		}
+	}
+
+	return media
+}
+
+// IsPublicMediaKey reports whether key is a processed image that may be
+// served to anyone.
+func IsPublicMediaKey(key string) bool {
+	return publicMediaKey.MatchString(key)
+}
+
+// mediaVariants loads the variants of files, grouped by media file.
+func (conf *APIConfig) mediaVariants(ctx context.Context, q *database.Queries, files []database.MediaFile) (map[uuid.UUID][]database.MediaVariant, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	variants, err := q.GetMediaVariantsByFiles(ctx, lo.Map(files, func(file database.MediaFile, _ int) uuid.UUID {
+		return file.ID
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	return lo.GroupBy(variants, func(variant database.MediaVariant) uuid.UUID {
+		return variant.MediaFileID
+	}), nil
+}
+
+// mediaBlobStore returns the store holding the StorageKey of file. Uploads
+// stay in the private store until they are processed.
+func (conf *APIConfig) mediaBlobStore(file database.MediaFile) blobstore.BlobStore {
+	if file.Status == mediaReady {
+		return conf.BlobStore
+	}
+
+	return conf.PrivateBlobStore
+}
+
+// deleteMediaBlobs deletes the blobs of file and of its variants.
+func (conf *APIConfig) deleteMediaBlobs(ctx context.Context, file database.MediaFile, variants []database.MediaVariant) error {
+	if err := conf.mediaBlobStore(file).Delete(ctx, file.StorageKey); err != nil {
+		return err
+	}
+
+	for _, variant := range variants {
+		if err := conf.BlobStore.Delete(ctx, variant.StorageKey); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// attachMedia attaches the uploaded media of userID to chirpID. It fails
+// unless every one of ids can be attached.
+func attachMedia(ctx context.Context, q *database.Queries, chirpID, userID uuid.UUID, ids []uuid.UUID) ([]database.MediaFile, error) {
+	ids = lo.Uniq(ids)
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	files, err := q.AttachMediaFiles(ctx, database.AttachMediaFilesParams{
+		ChirpID: uuid.NullUUID{UUID: chirpID, Valid: true},
+		Ids:     ids,
+		UserID:  userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) != len(ids) {
+		return nil, errUnknownMedia
+	}
+
+	return files, nil
+}
+
+// readUpload returns the contents of the file form field. The request body
+// is limited, so oversized uploads are never read into memory entirely.
+func (conf *APIConfig) readUpload(w http.ResponseWriter, r *http.Request) ([]byte, int, error) {
+	// Leave room for the multipart headers around the file.
+	r.Body = http.MaxBytesReader(w, r.Body, conf.MaxMediaBytes+1<<16)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, http.StatusBadRequest, fmt.Errorf("%s field is required", mediaFormField)
+		}
+
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, http.StatusRequestEntityTooLarge, err
+		} else if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+
+		if part.FormName() != mediaFormField {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, conf.MaxMediaBytes+1))
+		if errors.As(err, &tooLarge) || int64(len(data)) > conf.MaxMediaBytes {
+			return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("media must not exceed %d bytes", conf.MaxMediaBytes)
+		} else if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+
+		return data, http.StatusOK, nil
+	}
+}
+
+// UploadMediaHandler only checks the upload and stores it as is. Processing
+// happens in the background, see ProcessMedia.
+func (conf *APIConfig) UploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	data, status, err := conf.readUpload(w, r)
+	if err != nil {
+		errorRespond(w, r, status, err.Error())
+		return
+	}
+
+	// The declared content type is ignored, only the contents count.
+	contentType, config, err := mediaProcessor.Check(data)
+	if errors.Is(err, imageproc.ErrUnsupported) {
+		errorRespond(w, r, http.StatusUnsupportedMediaType, err.Error())
+		return
+	} else if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	mediaID := uuid.New()
+	// The upload may carry metadata, so it stays in the private store until
+	// it is replaced by its processed images.
+	key := mediaID.String() + "/upload"
+
+	if err = conf.PrivateBlobStore.Put(r.Context(), key, contentType, data); err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	file, err := conf.Database.CreateMediaFile(r.Context(), database.CreateMediaFileParams{
+		ID:          mediaID,
+		UserID:      userID,
+		StorageKey:  key,
+		ContentType: contentType,
+		SizeBytes:   int64(len(data)),
+		Width:       int32(config.Width),
+		Height:      int32(config.Height),
+	})
+	if err != nil {
+		_ = conf.PrivateBlobStore.Delete(r.Context(), key)
+
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	successRespond(w, r, http.StatusAccepted, conf.mediaFromDB(file, nil))
+}
+
+// ShowMediaHandler lets the uploader poll the processing status.
+func (conf *APIConfig) ShowMediaHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	mediaID, err := uuid.Parse(r.PathValue("media_id"))
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	file, err := conf.Database.GetMediaFile(r.Context(), mediaID)
+	if err != nil {
+		errorRespond(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if file.UserID != userID {
+		errorRespond(w, r, http.StatusForbidden, "user does not own media")
+		return
+	}
+
+	variants, err := conf.mediaVariants(r.Context(), conf.Database, []database.MediaFile{file})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, conf.mediaFromDB(file, variants[file.ID]))
+}
+
+// ProcessMedia claims pending uploads and processes them with a pool of
+// MediaWorkers goroutines. It is meant to be run periodically.
+func (conf *APIConfig) ProcessMedia(ctx context.Context) error {
+	workers := max(conf.MediaWorkers, 1)
+
+	files, err := conf.Database.ClaimPendingMediaFiles(ctx, database.ClaimPendingMediaFilesParams{
+		StaleBefore: time.Now().Add(-mediaProcessingTimeout),
+		Limit:       int32(workers * 2),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Each worker only writes the errors of the files it processed.
+	queue := make(chan int)
+	errs := make([]error, len(files))
+
+	var wg sync.WaitGroup
+
+	for range min(workers, len(files)) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range queue {
+				errs[i] = conf.processMediaFile(ctx, files[i])
+			}
+		}()
+	}
+
+	for i := range files {
+		queue <- i
+	}
+
+	close(queue)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// processMediaFile turns an upload into its sanitized original and
+// thumbnails. Images that cannot be processed are marked as failed, while
+// storage and database errors leave the file to be claimed again.
+func (conf *APIConfig) processMediaFile(ctx context.Context, file database.MediaFile) error {
+	upload, err := conf.PrivateBlobStore.Get(ctx, file.StorageKey)
+	if err != nil {
+		return err
+	}
+
+	result, err := mediaProcessor.Process(upload)
+	if err != nil {
+		slog.WarnContext(ctx, "unable to process media", "media_id", file.ID.String(), "error", err.Error())
+
+		if err = conf.Database.MarkMediaFileFailed(ctx, database.MarkMediaFileFailedParams{
+			ID:        file.ID,
+			LastError: sql.NullString{String: err.Error(), Valid: true},
+		}); err != nil {
+			return err
+		}
+
+		return conf.PrivateBlobStore.Delete(ctx, file.StorageKey)
+	}
+
+	prefix := file.ID.String() + "/"
+	originalKey := prefix + "original" + result.Original.Extension
+
+	if err = conf.BlobStore.Put(ctx, originalKey, result.Original.ContentType, result.Original.Data); err != nil {
+		return err
+	}
+
+	for name, thumbnail := range result.Thumbnails {
+		if err = conf.BlobStore.Put(ctx, prefix+name+thumbnail.Extension, thumbnail.ContentType, thumbnail.Data); err != nil {
+			return err
+		}
+	}
+
+	err = conf.Transactor.InTx(ctx, func(q *database.Queries) error {
+		for name, thumbnail := range result.Thumbnails {
+			err := q.UpsertMediaVariant(ctx, database.UpsertMediaVariantParams{
+				MediaFileID: file.ID,
+				Name:        name,
+				StorageKey:  prefix + name + thumbnail.Extension,
+				ContentType: thumbnail.ContentType,
+				Width:       int32(thumbnail.Width),
+				Height:      int32(thumbnail.Height),
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return q.MarkMediaFileReady(ctx, database.MarkMediaFileReadyParams{
+			ID:          file.ID,
+			StorageKey:  originalKey,
+			ContentType: result.Original.ContentType,
+			SizeBytes:   int64(len(result.Original.Data)),
+			Width:       int32(result.Original.Width),
+			Height:      int32(result.Original.Height),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return conf.PrivateBlobStore.Delete(ctx, file.StorageKey)
+}
+
+// PruneMedia deletes media that were not attached to a chirp within a day
+// of their upload, including failed ones and media of deleted chirps. It is
+// meant to be run periodically.
+func (conf *APIConfig) PruneMedia(ctx context.Context) error {
+	files, err := conf.Database.GetUnattachedMediaFiles(ctx, database.GetUnattachedMediaFilesParams{
+		CreatedAt: time.Now().Add(-unattachedMediaTTL),
+		Limit:     mediaPruneBatch,
+	})
+	if err != nil {
+		return err
+	}
+
+	variants, err := conf.mediaVariants(ctx, conf.Database, files)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err = conf.deleteMediaBlobs(ctx, file, variants[file.ID]); err != nil {
+			return err
+		}
+
+		if err = conf.Database.DeleteMediaFile(ctx, file.ID); err != nil {
+			return err
+		}
+	}
+
+	if len(files) > 0 {
+		slog.InfoContext(ctx, "pruned unattached media", "count", len(files))
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package domain
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+	"github.com/mashfeii/chirpy/pkg/entities"
+)
+
+// ChirpEntity is a mention or a hashtag of a chirp body, see entities.Entity
+// for the offsets. Mentions carry the ID of the mentioned user.
+type ChirpEntity struct {
+	Type   entities.Type `json:"type"`
+	Text   string        `json:"text"`
+	Start  int           `json:"start"`
+	End    int           `json:"end"`
+	UserID *uuid.UUID    `json:"user_id,omitempty"`
+}
+
+// chirpEntities parses the entities of body. Mentions are only kept when they
+// matched a username when the chirp was saved, so renaming a user does not
+// change past chirps.
+func chirpEntities(body string, mentions []database.ChirpMention) []ChirpEntity {
+	byHandle := lo.SliceToMap(mentions, func(mention database.ChirpMention) (string, uuid.UUID) {
+		return mention.Handle, mention.UserID
+	})
+
+	var converted []ChirpEntity
+
+	for _, entity := range entities.Parse(body) {
+		chirpEntity := ChirpEntity{
+			Type:  entity.Type,
+			Text:  entity.Value,
+			Start: entity.Start,
+			End:   entity.End,
+		}
+
+		if entity.Type == entities.Mention {
+			userID, ok := byHandle[entity.Value]
+			if !ok {
+				continue
+			}
+
+			chirpEntity.UserID = &userID
+		}
+
+		converted = append(converted, chirpEntity)
+	}
+
+	return converted
+}
+
+// saveChirpEntities records the mentions and hashtags of chirp, replacing the
+// previous ones of edited chirps, and returns the resolved mentions. Users
+// blocking the author or blocked by them are not resolved.
+func saveChirpEntities(ctx context.Context, q *database.Queries, chirp database.Chirp) ([]database.ChirpMention, error) {
+	if err := q.DeleteChirpMentions(ctx, chirp.ID); err != nil {
+		return nil, err
+	}
+
+	if err := q.DeleteChirpHashtags(ctx, chirp.ID); err != nil {
+		return nil, err
+	}
+
+	found := entities.Parse(chirp.Body)
+
+	if tags := entities.Values(found, entities.Hashtag); len(tags) > 0 {
+		err := q.CreateChirpHashtags(ctx, database.CreateChirpHashtagsParams{
+			ChirpID: chirp.ID,
+			Tags:    tags,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	handles := entities.Values(found, entities.Mention)
+	if len(handles) == 0 {
+		return nil, nil
+	}
+
+	return q.CreateChirpMentions(ctx, database.CreateChirpMentionsParams{
+		ChirpID:  chirp.ID,
+		Handles:  handles,
+		AuthorID: chirp.UserID,
+	})
+}
+
+func (conf *APIConfig) ShowHashtagChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	tag := strings.ToLower(strings.TrimPrefix(r.PathValue("tag"), "#"))
+
+	chirps, err := conf.Database.GetChirpsByHashtag(r.Context(), database.GetChirpsByHashtagParams{
+		Tag:      tag,
+		ViewerID: conf.viewer(r),
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	converted, err := conf.expandChirps(r.Context(), conf.Database, chirps)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, sortChirps(converted, r.URL.Query().Get("sort")))
+}
+
+func (conf *APIConfig) ShowMentionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("user_id"))
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err = conf.Database.GetUserByID(r.Context(), userID); err != nil {
+		errorRespond(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	chirps, err := conf.Database.GetChirpsMentioningUser(r.Context(), database.GetChirpsMentioningUserParams{
+		UserID:   userID,
+		ViewerID: conf.viewer(r),
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	converted, err := conf.expandChirps(r.Context(), conf.Database, chirps)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, sortChirps(converted, r.URL.Query().Get("sort")))
+}
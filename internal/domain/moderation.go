@@ -0,0 +1,557 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"github.com/mashfeii/chirpy/internal/application/outbox"
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+)
+
+const (
+	reportOpen     = "open"
+	reportTriaged  = "triaged"
+	reportResolved = "resolved"
+
+	ActionTriage      = "triage"
+	ActionDismiss     = "dismiss"
+	ActionHideChirp   = "hide_chirp"
+	ActionDeleteChirp = "delete_chirp"
+	ActionWarnUser    = "warn_user"
+	ActionSuspendUser = "suspend_user"
+
+	maxReportDetailsLength = 500
+	defaultModerationLimit = 50
+	maxModerationLimit     = 100
+)
+
+var (
+	reportReasons     = []string{"spam", "harassment", "hate", "violence", "sexual_content", "misinformation", "other"}
+	reportStatuses    = []string{reportOpen, reportTriaged, reportResolved}
+	resolutionActions = []string{ActionDismiss, ActionHideChirp, ActionDeleteChirp, ActionWarnUser, ActionSuspendUser}
+
+	errReportResolved = errors.New("report is already resolved")
+)
+
+type Report struct {
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	ChirpID        *uuid.UUID `json:"chirp_id"`
+	ReportedUserID uuid.UUID  `json:"reported_user_id"`
+	ReporterID     uuid.UUID  `json:"reporter_id"`
+	Reason         string     `json:"reason"`
+	Details        string     `json:"details"`
+	Status         string     `json:"status"`
+	AssigneeID     *uuid.UUID `json:"assignee_id,omitempty"`
+	Resolution     string     `json:"resolution,omitempty"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+}
+
+// ModerationAction is an entry of the audit trail of moderators.
+type ModerationAction struct {
+	ID           uuid.UUID  `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ModeratorID  uuid.UUID  `json:"moderator_id"`
+	Action       string     `json:"action"`
+	ReportID     *uuid.UUID `json:"report_id,omitempty"`
+	ChirpID      *uuid.UUID `json:"chirp_id,omitempty"`
+	TargetUserID *uuid.UUID `json:"target_user_id,omitempty"`
+	Note         string     `json:"note"`
+}
+
+// Warning is a warn_user action as seen by the warned user, without the
+// moderator who issued it.
+type Warning struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ChirpID   *uuid.UUID `json:"chirp_id,omitempty"`
+	Note      string     `json:"note"`
+}
+
+func nullableUUID(id uuid.NullUUID) *uuid.UUID {
+	return lo.Ternary(id.Valid, &id.UUID, nil)
+}
+
+func reportFromDB(report database.Report) Report {
+	return Report{
+		ID:             report.ID,
+		CreatedAt:      report.CreatedAt,
+		UpdatedAt:      report.UpdatedAt,
+		ChirpID:        nullableUUID(report.ChirpID),
+		ReportedUserID: report.ReportedUserID,
+		ReporterID:     report.ReporterID,
+		Reason:         report.Reason,
+		Details:        report.Details,
+		Status:         report.Status,
+		AssigneeID:     nullableUUID(report.AssigneeID),
+		Resolution:     report.Resolution.String,
+		ResolvedAt:     lo.Ternary(report.ResolvedAt.Valid, &report.ResolvedAt.Time, nil),
+	}
+}
+
+func moderationActionFromDB(action database.ModerationAction) ModerationAction {
+	return ModerationAction{
+		ID:           action.ID,
+		CreatedAt:    action.CreatedAt,
+		ModeratorID:  action.ModeratorID,
+		Action:       action.Action,
+		ReportID:     nullableUUID(action.ReportID),
+		ChirpID:      nullableUUID(action.ChirpID),
+		TargetUserID: nullableUUID(action.TargetUserID),
+		Note:         action.Note,
+	}
+}
+
+// ReportChirpHandler flags a chirp for moderators. A user reports a chirp at
+// most once.
+func (conf *APIConfig) ReportChirpHandler(w http.ResponseWriter, r *http.Request) {
+	type parameter struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirp_id"))
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	chirp, err := conf.Database.GetChirp(r.Context(), chirpID)
+	if err != nil || !chirp.Published {
+		errorRespond(w, r, http.StatusNotFound, sql.ErrNoRows.Error())
+		return
+	}
+
+	if chirp.UserID == userID {
+		errorRespond(w, r, http.StatusBadRequest, "users cannot report their own chirps")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+
+	var params parameter
+
+	if err = decoder.Decode(&params); err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !slices.Contains(reportReasons, params.Reason) {
+		errorRespond(w, r, http.StatusBadRequest, "reason must be one of "+strings.Join(reportReasons, ", "))
+		return
+	}
+
+	details := strings.TrimSpace(params.Details)
+
+	if utf8.RuneCountInString(details) > maxReportDetailsLength {
+		errorRespond(w, r, http.StatusBadRequest, fmt.Sprintf("details must be at most %d characters", maxReportDetailsLength))
+		return
+	}
+
+	report, err := conf.Database.CreateReport(r.Context(), database.CreateReportParams{
+		ChirpID:        chirp.ID,
+		ReportedUserID: chirp.UserID,
+		ReporterID:     userID,
+		Reason:         params.Reason,
+		Details:        details,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		errorRespond(w, r, http.StatusConflict, "chirp is already reported by the user")
+		return
+	} else if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusCreated, reportFromDB(report))
+}
+
+// ShowWarningsHandler lists the warnings moderators issued to the user.
+func (conf *APIConfig) ShowWarningsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	warnings, err := conf.Database.GetWarningsByUser(r.Context(), uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, lo.Map(warnings, func(warning database.ModerationAction, _ int) Warning {
+		return Warning{
+			ID:        warning.ID,
+			CreatedAt: warning.CreatedAt,
+			ChirpID:   nullableUUID(warning.ChirpID),
+			Note:      warning.Note,
+		}
+	}))
+}
+
+// decodeNote reads the optional {"note": "..."} body of moderation actions.
+func decodeNote(r *http.Request) (string, error) {
+	var params struct {
+		Note string `json:"note"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	return strings.TrimSpace(params.Note), nil
+}
+
+// moderationLimit reads the limit query parameter of moderation listings.
+func moderationLimit(r *http.Request) (int32, error) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return defaultModerationLimit, nil
+	}
+
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 || limit > maxModerationLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxModerationLimit)
+	}
+
+	return int32(limit), nil
+}
+
+// ShowReportsHandler lists the reports of a status, oldest first so that the
+// queue is worked through in order. The status defaults to open.
+func (conf *APIConfig) ShowReportsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = reportOpen
+	}
+
+	if !slices.Contains(reportStatuses, status) {
+		errorRespond(w, r, http.StatusBadRequest, "status must be one of "+strings.Join(reportStatuses, ", "))
+		return
+	}
+
+	limit, err := moderationLimit(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	reports, err := conf.Database.GetReports(r.Context(), database.GetReportsParams{
+		Status: status,
+		Limit:  limit,
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, lo.Map(reports, func(report database.Report, _ int) Report {
+		return reportFromDB(report)
+	}))
+}
+
+// ShowReportHandler returns a report along with the reported chirp, hidden
+// or not, and the actions taken on the report.
+func (conf *APIConfig) ShowReportHandler(w http.ResponseWriter, r *http.Request) {
+	type returnValue struct {
+		Report
+		Chirp   *Chirp             `json:"chirp,omitempty"`
+		Actions []ModerationAction `json:"actions"`
+	}
+
+	reportID, err := uuid.Parse(r.PathValue("report_id"))
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := conf.Database.GetReport(r.Context(), reportID)
+	if err != nil {
+		errorRespond(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	response := returnValue{Report: reportFromDB(report)}
+
+	if report.ChirpID.Valid {
+		chirp, err := conf.Database.GetChirp(r.Context(), report.ChirpID.UUID)
+		if err != nil {
+			errorRespond(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		expanded, err := conf.expandChirp(r.Context(), chirp)
+		if err != nil {
+			errorRespond(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		response.Chirp = &expanded
+	}
+
+	actions, err := conf.Database.GetModerationActions(r.Context(), database.GetModerationActionsParams{
+		ReportID: uuid.NullUUID{UUID: report.ID, Valid: true},
+		Limit:    maxModerationLimit,
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.Actions = lo.Map(actions, func(action database.ModerationAction, _ int) ModerationAction {
+		return moderationActionFromDB(action)
+	})
+
+	successRespond(w, r, http.StatusOK, response)
+}
+
+// TriageReportHandler assigns a report to the moderator reviewing it.
+func (conf *APIConfig) TriageReportHandler(w http.ResponseWriter, r *http.Request) {
+	moderatorID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	reportID, err := uuid.Parse(r.PathValue("report_id"))
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	note, err := decodeNote(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := conf.Database.GetReport(r.Context(), reportID)
+	if err != nil {
+		errorRespond(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	err = conf.Transactor.InTx(r.Context(), func(q *database.Queries) error {
+		report, err = q.TriageReport(r.Context(), database.TriageReportParams{
+			AssigneeID: moderatorID,
+			ID:         report.ID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return errReportResolved
+		} else if err != nil {
+			return err
+		}
+
+		return q.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+			ModeratorID:  moderatorID,
+			Action:       ActionTriage,
+			ReportID:     uuid.NullUUID{UUID: report.ID, Valid: true},
+			ChirpID:      report.ChirpID,
+			TargetUserID: uuid.NullUUID{UUID: report.ReportedUserID, Valid: true},
+			Note:         note,
+		})
+	})
+	if errors.Is(err, errReportResolved) {
+		errorRespond(w, r, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, reportFromDB(report))
+}
+
+// ResolveReportHandler closes a report with one of resolutionActions and
+// records it in the audit trail. Suspensions use the note as their reason
+// and last suspension_days, or indefinitely when it is omitted.
+func (conf *APIConfig) ResolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	type parameter struct {
+		Action         string `json:"action"`
+		Note           string `json:"note"`
+		SuspensionDays *int   `json:"suspension_days"`
+	}
+
+	moderatorID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	reportID, err := uuid.Parse(r.PathValue("report_id"))
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+
+	var params parameter
+
+	if err = decoder.Decode(&params); err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !slices.Contains(resolutionActions, params.Action) {
+		errorRespond(w, r, http.StatusBadRequest, "action must be one of "+strings.Join(resolutionActions, ", "))
+		return
+	}
+
+	note := strings.TrimSpace(params.Note)
+
+	var expiresAt sql.NullTime
+
+	if params.Action == ActionSuspendUser {
+		if note == "" {
+			errorRespond(w, r, http.StatusBadRequest, "a suspension needs a note giving its reason")
+			return
+		}
+
+		if expiresAt, err = suspensionExpiry(params.SuspensionDays); err != nil {
+			errorRespond(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	report, err := conf.Database.GetReport(r.Context(), reportID)
+	if err != nil {
+		errorRespond(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if (params.Action == ActionHideChirp || params.Action == ActionDeleteChirp) && !report.ChirpID.Valid {
+		errorRespond(w, r, http.StatusConflict, "reported chirp no longer exists")
+		return
+	}
+
+	err = conf.Transactor.InTx(r.Context(), func(q *database.Queries) error {
+		report, err = q.ResolveReport(r.Context(), database.ResolveReportParams{
+			Resolution: params.Action,
+			ID:         report.ID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return errReportResolved
+		} else if err != nil {
+			return err
+		}
+
+		switch params.Action {
+		case ActionHideChirp:
+			_, err = q.HideChirp(r.Context(), report.ChirpID.UUID)
+		case ActionDeleteChirp:
+			err = deleteReportedChirp(r.Context(), q, report.ChirpID.UUID)
+		case ActionSuspendUser:
+			_, err = q.CreateUserSuspension(r.Context(), database.CreateUserSuspensionParams{
+				UserID:    report.ReportedUserID,
+				Reason:    note,
+				ExpiresAt: expiresAt,
+			})
+			if err == nil {
+				err = writeStateChange(r.Context(), q, report.ReportedUserID, ActionSuspendUser)
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return q.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+			ModeratorID:  moderatorID,
+			Action:       params.Action,
+			ReportID:     uuid.NullUUID{UUID: report.ID, Valid: true},
+			ChirpID:      report.ChirpID,
+			TargetUserID: uuid.NullUUID{UUID: report.ReportedUserID, Valid: true},
+			Note:         note,
+		})
+	})
+	if errors.Is(err, errReportResolved) {
+		errorRespond(w, r, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, reportFromDB(report))
+}
+
+// deleteReportedChirp deletes a chirp the way its author would, announcing
+// it to webhooks and streams.
+func deleteReportedChirp(ctx context.Context, q *database.Queries, chirpID uuid.UUID) error {
+	chirp, err := q.GetChirp(ctx, chirpID)
+	if err != nil {
+		return err
+	}
+
+	if err = q.DeleteChirp(ctx, chirp.ID); err != nil || !chirp.Published {
+		return err
+	}
+
+	return outbox.Write(ctx, q, ChirpDeletedEvent, chirp.UserID, chirpFromDB(chirp))
+}
+
+// ShowModerationActionsHandler lists the audit trail, newest first,
+// optionally restricted to a report_id or a target user_id.
+func (conf *APIConfig) ShowModerationActionsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, err := moderationLimit(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.GetModerationActionsParams{Limit: limit}
+
+	if raw := query.Get("report_id"); raw != "" {
+		reportID, err := uuid.Parse(raw)
+		if err != nil {
+			errorRespond(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		params.ReportID = uuid.NullUUID{UUID: reportID, Valid: true}
+	}
+
+	if raw := query.Get("user_id"); raw != "" {
+		userID, err := uuid.Parse(raw)
+		if err != nil {
+			errorRespond(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		params.TargetUserID = uuid.NullUUID{UUID: userID, Valid: true}
+	}
+
+	actions, err := conf.Database.GetModerationActions(r.Context(), params)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, lo.Map(actions, func(action database.ModerationAction, _ int) ModerationAction {
+		return moderationActionFromDB(action)
+	}))
+}
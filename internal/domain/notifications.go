@@ -0,0 +1,237 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"github.com/mashfeii/chirpy/internal/application/outbox"
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+	"github.com/mashfeii/chirpy/pkg/entities"
+)
+
+const (
+	MentionNotification = "mention"
+
+	defaultNotificationsLimit = 20
+	maxNotificationsLimit     = 100
+	// notificationActorsShown bounds the actors listed with a notification,
+	// ActorCount telling how many there are.
+	notificationActorsShown = 3
+)
+
+// Notification groups the actions of the same type that the user has not
+// read yet, e.g. three people mentioning them. ChirpID is the latest chirp.
+type Notification struct {
+	ID         uuid.UUID   `json:"id"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+	Type       string      `json:"type"`
+	ChirpID    *uuid.UUID  `json:"chirp_id,omitempty"`
+	ActorIDs   []uuid.UUID `json:"actor_ids"`
+	ActorCount int32       `json:"actor_count"`
+	Read       bool        `json:"read"`
+}
+
+func notificationFromDB(notification database.Notification) Notification {
+	converted := Notification{
+		ID:         notification.ID,
+		CreatedAt:  notification.CreatedAt,
+		UpdatedAt:  notification.UpdatedAt,
+		Type:       notification.Type,
+		ActorIDs:   lo.Slice(notification.ActorIds, 0, notificationActorsShown),
+		ActorCount: notification.ActorCount,
+		Read:       notification.ReadAt.Valid,
+	}
+
+	if notification.ChirpID.Valid {
+		converted.ChirpID = &notification.ChirpID.UUID
+	}
+
+	return converted
+}
+
+// notificationGroupKey tells apart the unread groups of a type. Every chirp
+// has a single author, so mentions are grouped per user, pointing at the
+// latest chirp; other types would be grouped per chirp.
+func notificationGroupKey(notificationType string, chirpID uuid.NullUUID) string {
+	if notificationType == MentionNotification || !chirpID.Valid {
+		return ""
+	}
+
+	return chirpID.UUID.String()
+}
+
+// notify records that actorID did something notificationType to userID,
+// grouped with the unread notification of the same group. Users are not
+// notified of their own actions, and an actor counts once per group.
+func notify(ctx context.Context, q *database.Queries, userID uuid.UUID, notificationType string, chirpID uuid.NullUUID, actorID uuid.UUID) error {
+	if userID == actorID {
+		return nil
+	}
+
+	return q.UpsertNotification(ctx, database.UpsertNotificationParams{
+		UserID:   userID,
+		Type:     notificationType,
+		ChirpID:  chirpID,
+		GroupKey: notificationGroupKey(notificationType, chirpID),
+		ActorID:  actorID,
+	})
+}
+
+// CreateNotifications is an outbox sink turning events into notifications.
+// Mentions are notified when the chirp is published, not when it is edited.
+func (conf *APIConfig) CreateNotifications(ctx context.Context, q *database.Queries, event outbox.Event) error {
+	if event.Type != ChirpCreatedEvent {
+		return nil
+	}
+
+	envelope, err := event.Envelope()
+	if err != nil {
+		return err
+	}
+
+	var chirp Chirp
+
+	if err = json.Unmarshal(envelope.Data, &chirp); err != nil {
+		return err
+	}
+
+	for _, entity := range chirp.Entities {
+		if entity.Type != entities.Mention || entity.UserID == nil {
+			continue
+		}
+
+		err = notify(ctx, q, *entity.UserID, MentionNotification, uuid.NullUUID{UUID: chirp.ID, Valid: true}, chirp.UserID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ShowNotificationsHandler lists the notifications of the user, most recently
+// updated first. Pages are fetched by passing the updated_at and id of the
+// last notification as before and before_id.
+func (conf *APIConfig) ShowNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+
+	params := database.GetNotificationsParams{
+		UserID:     userID,
+		UnreadOnly: query.Get("unread") == "true",
+		Limit:      defaultNotificationsLimit,
+	}
+
+	if raw := query.Get("before"); raw != "" {
+		before, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			errorRespond(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		params.Before = sql.NullTime{Time: before, Valid: true}
+	}
+
+	if raw := query.Get("before_id"); raw != "" {
+		beforeID, err := uuid.Parse(raw)
+		if err != nil {
+			errorRespond(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		params.BeforeID = beforeID
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > maxNotificationsLimit {
+			errorRespond(w, r, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxNotificationsLimit))
+			return
+		}
+
+		params.Limit = int32(limit)
+	}
+
+	notifications, err := conf.Database.GetNotifications(r.Context(), params)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, lo.Map(notifications, func(notification database.Notification, _ int) Notification {
+		return notificationFromDB(notification)
+	}))
+}
+
+func (conf *APIConfig) UnreadNotificationsCountHandler(w http.ResponseWriter, r *http.Request) {
+	type returnValue struct {
+		Count int64 `json:"count"`
+	}
+
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	count, err := conf.Database.CountUnreadNotifications(r.Context(), userID)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, returnValue{Count: count})
+}
+
+func (conf *APIConfig) ReadNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	notificationID, err := uuid.Parse(r.PathValue("notification_id"))
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	notification, err := conf.Database.MarkNotificationRead(r.Context(), database.MarkNotificationReadParams{
+		ID:     notificationID,
+		UserID: userID,
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, notificationFromDB(notification))
+}
+
+func (conf *APIConfig) ReadAllNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	if err = conf.Database.MarkAllNotificationsRead(r.Context(), userID); err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusNoContent, nil)
+}
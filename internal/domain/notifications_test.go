@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+)
+
+// testQueries returns queries bound to a transaction of the migrated database
+// at CHIRPY_TEST_DB_URL that is rolled back after the test.
+func testQueries(t *testing.T) *database.Queries {
+	t.Helper()
+
+	url := os.Getenv("CHIRPY_TEST_DB_URL")
+	if url == "" {
+		t.Skip("CHIRPY_TEST_DB_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	if err = database.CheckSchemaVersion(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = tx.Rollback() })
+
+	return database.New(tx)
+}
+
+func TestNotifyGroupsMentionsOfSeveralActors(t *testing.T) {
+	ctx := context.Background()
+	q := testQueries(t)
+
+	createUser := func(name string) database.User {
+		user, err := q.CreateUser(ctx, database.CreateUserParams{
+			Email:          name + "-" + uuid.NewString() + "@example.com",
+			HashedPassword: "unused",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return user
+	}
+
+	recipient := createUser("recipient")
+
+	var lastChirp uuid.UUID
+
+	for _, actor := range []database.User{createUser("alice"), createUser("bob")} {
+		chirp, err := q.CreateChirp(ctx, database.CreateChirpParams{
+			Body:      "hello @recipient",
+			UserID:    actor.ID,
+			Published: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lastChirp = chirp.ID
+
+		err = notify(ctx, q, recipient.ID, MentionNotification, uuid.NullUUID{UUID: chirp.ID, Valid: true}, actor.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	notifications, err := q.GetNotifications(ctx, database.GetNotificationsParams{
+		UserID: recipient.ID,
+		Limit:  defaultNotificationsLimit,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(notifications) != 1 {
+		t.Fatalf("got %d notifications, want the two mentions in one", len(notifications))
+	}
+
+	if got := notifications[0]; got.ActorCount != 2 || len(got.ActorIds) != 2 {
+		t.Errorf("actor_count = %d with %d actors, want 2", got.ActorCount, len(got.ActorIds))
+	}
+
+	if got := notifications[0].ChirpID; got.UUID != lastChirp {
+		t.Errorf("chirp_id = %s, want the latest chirp %s", got.UUID, lastChirp)
+	}
+}
@@ -0,0 +1,219 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/mashfeii/chirpy/internal/application/outbox"
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+)
+
+var errAvatarMedia = errors.New("avatar must be a processed upload of the user")
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+)
+
+// Profile is the public view of a user. It must never carry private fields
+// like the email.
+type Profile struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Username    string    `json:"username,omitempty"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	Avatar      *Media    `json:"avatar,omitempty"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ChirpCount  int64     `json:"chirp_count"`
+}
+
+// eventProfile is the profile carried by user events. Events reach webhooks
+// of other users, so it is the public profile, without the avatar and counts
+// that would take more queries.
+func eventProfile(user database.User) Profile {
+	return Profile{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		Username:    user.Username.String,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		IsChirpyRed: user.IsChirpyRed,
+	}
+}
+
+// profile builds the public profile of user with its avatar and counts.
+func (conf *APIConfig) profile(ctx context.Context, user database.User) (Profile, error) {
+	profile := Profile{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		Username:    user.Username.String,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		IsChirpyRed: user.IsChirpyRed,
+	}
+
+	if user.AvatarMediaID.Valid {
+		file, err := conf.Database.GetMediaFile(ctx, user.AvatarMediaID.UUID)
+		if err != nil {
+			return Profile{}, err
+		}
+
+		variants, err := conf.mediaVariants(ctx, conf.Database, []database.MediaFile{file})
+		if err != nil {
+			return Profile{}, err
+		}
+
+		avatar := conf.mediaFromDB(file, variants[file.ID])
+		profile.Avatar = &avatar
+	}
+
+	count, err := conf.Database.CountChirpsByUser(ctx, user.ID)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	profile.ChirpCount = count
+
+	return profile, nil
+}
+
+func (conf *APIConfig) ShowProfileHandler(w http.ResponseWriter, r *http.Request) {
+	username, err := parseUsername(r.PathValue("username"))
+	if err != nil || !username.Valid {
+		errorRespond(w, r, http.StatusNotFound, "user not found")
+		return
+	}
+
+	user, err := conf.Database.GetUserByUsername(r.Context(), username)
+	if err != nil || user.DeactivatedAt.Valid {
+		errorRespond(w, r, http.StatusNotFound, "user not found")
+		return
+	}
+
+	profile, err := conf.profile(r.Context(), user)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, profile)
+}
+
+// UpdateProfileHandler changes the given fields of the profile of the
+// authenticated user. An empty avatar_id removes the avatar.
+func (conf *APIConfig) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	type parameter struct {
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+		AvatarID    *string `json:"avatar_id"`
+	}
+
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+
+	var params parameter
+
+	if err = decoder.Decode(&params); err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := conf.Database.GetUserByID(r.Context(), userID)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	update := database.UpdateUserProfileParams{
+		ID:            user.ID,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		AvatarMediaID: user.AvatarMediaID,
+	}
+
+	if params.DisplayName != nil {
+		if update.DisplayName, err = profileText("display_name", *params.DisplayName, maxDisplayNameLength); err != nil {
+			errorRespond(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if params.Bio != nil {
+		if update.Bio, err = profileText("bio", *params.Bio, maxBioLength); err != nil {
+			errorRespond(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if params.AvatarID != nil {
+		if update.AvatarMediaID, err = conf.avatarMedia(r.Context(), userID, *params.AvatarID); err != nil {
+			errorRespond(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	err = conf.Transactor.InTx(r.Context(), func(q *database.Queries) error {
+		user, err = q.UpdateUserProfile(r.Context(), update)
+		if err != nil {
+			return err
+		}
+
+		return outbox.Write(r.Context(), q, UserUpdatedEvent, userID, eventProfile(user))
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	profile, err := conf.profile(r.Context(), user)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, profile)
+}
+
+func profileText(field, value string, maxLength int) (string, error) {
+	value = strings.TrimSpace(value)
+
+	if utf8.RuneCountInString(value) > maxLength {
+		return "", fmt.Errorf("%s must not exceed %d characters", field, maxLength)
+	}
+
+	return value, nil
+}
+
+// avatarMedia checks that id is processed media of userID. An empty id
+// removes the avatar.
+func (conf *APIConfig) avatarMedia(ctx context.Context, userID uuid.UUID, id string) (uuid.NullUUID, error) {
+	if id == "" {
+		return uuid.NullUUID{}, nil
+	}
+
+	mediaID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+
+	file, err := conf.Database.GetMediaFile(ctx, mediaID)
+	if err != nil || file.UserID != userID || file.Status != mediaReady {
+		return uuid.NullUUID{}, errAvatarMedia
+	}
+
+	return uuid.NullUUID{UUID: mediaID, Valid: true}, nil
+}
@@ -0,0 +1,116 @@
+package domain
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mashfeii/chirpy/internal/infrastructure/api"
+	"github.com/mashfeii/chirpy/pkg/auth"
+	"github.com/mashfeii/chirpy/pkg/ratelimit"
+)
+
+// DefaultRateLimits are applied to the routes that create resources or
+// check credentials. Each of them can be overridden through RATE_LIMITS.
+var DefaultRateLimits = map[string]ratelimit.Limit{
+	"POST /api/users":                                    {Requests: 5, Per: time.Hour},
+	"POST /api/login":                                    {Requests: 10, Per: time.Minute},
+	"DELETE /api/users/me":                               {Requests: 5, Per: time.Hour},
+	"POST /api/refresh":                                  {Requests: 30, Per: time.Minute},
+	"POST /api/chirps":                                   {Requests: 30, Per: time.Minute},
+	"POST /api/chirps/{chirp_id}/report":                 {Requests: 10, Per: time.Minute},
+	"POST /api/drafts/{draft_id}/publish":                {Requests: 30, Per: time.Minute},
+	"POST /api/media":                                    {Requests: 30, Per: time.Minute},
+	"POST /api/conversations":                            {Requests: 10, Per: time.Minute},
+	"POST /api/conversations/{conversation_id}/messages": {Requests: 60, Per: time.Minute},
+}
+
+// ParseRateLimits reads limits in "METHOD /path=requests/period" form,
+// separated by commas, on top of DefaultRateLimits.
+func ParseRateLimits(raw string) (map[string]ratelimit.Limit, error) {
+	limits := make(map[string]ratelimit.Limit, len(DefaultRateLimits))
+
+	for route, limit := range DefaultRateLimits {
+		limits[route] = limit
+	}
+
+	for _, entry := range strings.Split(raw, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		route, rawLimit, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("rate limit %q is not in route=limit form", entry)
+		}
+
+		limit, err := ratelimit.ParseLimit(rawLimit)
+		if err != nil {
+			return nil, err
+		}
+
+		limits[strings.TrimSpace(route)] = limit
+	}
+
+	return limits, nil
+}
+
+// rateLimitBucket buckets requests with a valid JWT by user and the others
+// by client IP. Authenticated users get the limit scaled by their tier. Only
+// the token is checked, the handler then authenticates the request fully, and
+// tiers are cached so that limiting a request rarely costs a query.
+func (conf *APIConfig) rateLimitBucket(r *http.Request, limit ratelimit.Limit) (string, ratelimit.Limit) {
+	token, err := auth.GetAuthorizationToken(r.Header, "Bearer")
+	if err != nil {
+		return "ip:" + api.ClientIP(r), limit
+	}
+
+	userID, err := auth.ValidateJWT(token, conf.Secret)
+	if err != nil {
+		return "ip:" + api.ClientIP(r), limit
+	}
+
+	tier, ok := conf.TierCache.Get(userID)
+	if !ok {
+		if user, err := conf.Database.GetUserByID(r.Context(), userID); err == nil {
+			tier, ok = TierOf(user), true
+			conf.TierCache.Set(userID, tier)
+		}
+	}
+
+	if ok {
+		limit.Requests *= TierEntitlements[tier].RateLimitMultiplier
+	}
+
+	return "user:" + userID.String(), limit
+}
+
+// MiddlewareRateLimit applies the limit configured for the route a request
+// is going to be dispatched to by mux, if there is one.
+func (conf *APIConfig) MiddlewareRateLimit(mux *http.ServeMux) http.Handler {
+	limited := make(map[string]http.Handler, len(conf.RateLimits))
+
+	for route, limit := range conf.RateLimits {
+		limited[route] = api.MiddlewareRateLimit(conf.RateLimiter, func(r *http.Request) (string, ratelimit.Limit) {
+			key, limit := conf.rateLimitBucket(r, limit)
+
+			return route + "|" + key, limit
+		}, mux)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+
+		// Rejected requests never reach mux, set the pattern for the
+		// middlewares that report it.
+		r.Pattern = route
+
+		if handler, ok := limited[route]; ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,234 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mashfeii/chirpy/internal/application/outbox"
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+)
+
+const (
+	maxScheduleAhead = 365 * 24 * time.Hour
+	publishBatchSize = 100
+)
+
+// validatePublishAt checks a requested publication time. A missing one means
+// the chirp is published right away.
+func validatePublishAt(publishAt *time.Time, now time.Time) (sql.NullTime, error) {
+	if publishAt == nil {
+		return sql.NullTime{}, nil
+	}
+
+	if !publishAt.After(now) {
+		return sql.NullTime{}, errors.New("publish_at must be in the future")
+	}
+
+	if publishAt.After(now.Add(maxScheduleAhead)) {
+		return sql.NullTime{}, errors.New("publish_at must be within a year")
+	}
+
+	return sql.NullTime{Time: publishAt.UTC(), Valid: true}, nil
+}
+
+// PublishScheduledChirps publishes the scheduled chirps that are due, with
+// the same events, metrics and statistics as chirps published right away.
+// It is meant to be run periodically.
+func (conf *APIConfig) PublishScheduledChirps(ctx context.Context) error {
+	var published []database.Chirp
+
+	err := conf.Transactor.InTx(ctx, func(q *database.Queries) error {
+		chirps, err := q.PublishDueChirps(ctx, publishBatchSize)
+		if err != nil {
+			return err
+		}
+
+		converted, err := conf.expandChirps(ctx, q, chirps)
+		if err != nil {
+			return err
+		}
+
+		for _, chirp := range converted {
+			if err = outbox.Write(ctx, q, ChirpCreatedEvent, chirp.UserID, chirp); err != nil {
+				return err
+			}
+		}
+
+		published = chirps
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for range published {
+		conf.Metrics.ChirpsCreated.Inc()
+		conf.recordStat(StatChirps)
+	}
+
+	return nil
+}
+
+func (conf *APIConfig) ShowScheduledChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	chirps, err := conf.Database.GetScheduledChirpsByUser(r.Context(), userID)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	converted, err := conf.expandChirps(r.Context(), conf.Database, chirps)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, converted)
+}
+
+// ownedScheduledChirp loads the scheduled chirp from the chirp_id path value
+// and checks that it belongs to the authenticated user.
+func (conf *APIConfig) ownedScheduledChirp(w http.ResponseWriter, r *http.Request) (database.Chirp, bool) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return database.Chirp{}, false
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirp_id"))
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return database.Chirp{}, false
+	}
+
+	chirp, err := conf.Database.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		errorRespond(w, r, http.StatusNotFound, err.Error())
+		return database.Chirp{}, false
+	}
+
+	if chirp.UserID != userID {
+		errorRespond(w, r, http.StatusForbidden, "user does not own chirp")
+		return database.Chirp{}, false
+	}
+
+	if chirp.Published {
+		errorRespond(w, r, http.StatusConflict, "chirp has already been published")
+		return database.Chirp{}, false
+	}
+
+	return chirp, true
+}
+
+func (conf *APIConfig) UpdateScheduledChirpHandler(w http.ResponseWriter, r *http.Request) {
+	type parameter struct {
+		Body      *string    `json:"body"`
+		PublishAt *time.Time `json:"publish_at"`
+	}
+
+	chirp, ok := conf.ownedScheduledChirp(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+
+	var params parameter
+
+	if err := decoder.Decode(&params); err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entitlements, err := conf.entitlements(r.Context(), chirp.UserID)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	if !entitlements.ScheduleChirps {
+		errorRespond(w, r, http.StatusForbidden, "scheduling chirps requires Chirpy Red")
+		return
+	}
+
+	body := chirp.Body
+
+	if params.Body != nil {
+		if body, err = cleanChirpBody(*params.Body, entitlements); err != nil {
+			errorRespond(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	publishAt := chirp.PublishAt
+
+	if params.PublishAt != nil {
+		if publishAt, err = validatePublishAt(params.PublishAt, time.Now()); err != nil {
+			errorRespond(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	err = conf.Transactor.InTx(r.Context(), func(q *database.Queries) error {
+		chirp, err = q.UpdateScheduledChirp(r.Context(), database.UpdateScheduledChirpParams{
+			ID:        chirp.ID,
+			Body:      body,
+			PublishAt: publishAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = saveChirpEntities(r.Context(), q, chirp)
+
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// The scheduler got to it first.
+		errorRespond(w, r, http.StatusConflict, "chirp has already been published")
+		return
+	} else if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response, err := conf.expandChirp(r.Context(), chirp)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, response)
+}
+
+func (conf *APIConfig) CancelScheduledChirpHandler(w http.ResponseWriter, r *http.Request) {
+	chirp, ok := conf.ownedScheduledChirp(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := conf.Database.DeleteScheduledChirp(r.Context(), chirp.ID)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if deleted == 0 {
+		errorRespond(w, r, http.StatusConflict, "chirp has already been published")
+		return
+	}
+
+	successRespond(w, r, http.StatusNoContent, nil)
+}
@@ -0,0 +1,318 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"github.com/mashfeii/chirpy/internal/application/outbox"
+	"github.com/mashfeii/chirpy/internal/infrastructure/logging"
+	"github.com/mashfeii/chirpy/pkg/auth"
+)
+
+const (
+	StreamBufferSize = 64
+
+	streamHeartbeat    = 25 * time.Second
+	streamWriteTimeout = 10 * time.Second
+)
+
+var streamedEvents = []string{ChirpCreatedEvent, ChirpDeletedEvent}
+
+// StreamMessage is a chirp event as pushed to stream clients.
+type StreamMessage struct {
+	ID       uuid.UUID       `json:"id"`
+	Type     string          `json:"type"`
+	AuthorID uuid.UUID       `json:"author_id"`
+	Data     json.RawMessage `json:"data"`
+}
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// PublishToStream forwards chirp events from the outbox bus to the stream
+// hub. The hub never blocks, so neither does the outbox dispatcher.
+func (conf *APIConfig) PublishToStream(event outbox.Event) {
+	if !slices.Contains(streamedEvents, event.Type) {
+		return
+	}
+
+	envelope, err := event.Envelope()
+	if err != nil {
+		slog.Error("unable to decode event", "event_id", event.ID.String(), "error", err.Error())
+		return
+	}
+
+	conf.StreamHub.Publish(StreamMessage{
+		ID:       event.ID,
+		Type:     event.Type,
+		AuthorID: event.UserID,
+		Data:     envelope.Data,
+	})
+}
+
+// authenticateStream accepts the JWT either as a bearer token or as the
+// access_token query parameter, since browsers cannot set headers on
+// EventSource and WebSocket connections.
+func (conf *APIConfig) authenticateStream(r *http.Request) (uuid.UUID, error) {
+	token := r.URL.Query().Get("access_token")
+	if token == "" {
+		return conf.authenticate(r)
+	}
+
+	userID, err := auth.ValidateJWT(token, conf.Secret)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if err = conf.checkAccount(r.Context(), userID); err != nil {
+		return uuid.Nil, err
+	}
+
+	logging.SetUserID(r.Context(), userID)
+
+	return userID, nil
+}
+
+// streamRevoked re-checks the account of userID, returning why a stream that
+// is already open must be closed. Streams call it on every heartbeat so that
+// suspensions and deactivations apply within streamHeartbeat, whichever
+// instance they were made on. Other errors keep the stream open.
+func (conf *APIConfig) streamRevoked(ctx context.Context, userID uuid.UUID) (string, bool) {
+	err := conf.checkAccount(ctx, userID)
+
+	var stateErr *accountStateError
+	if errors.As(err, &stateErr) {
+		return stateErr.Error(), true
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return "account is deleted", true
+	}
+
+	if err != nil {
+		slog.WarnContext(ctx, "unable to check account", "error", err.Error())
+	}
+
+	return "", false
+}
+
+// streamFilter builds the subscription filter from the author_id and events
+// query parameters. Both can be repeated and default to everything. Messages
+// of hidden authors are always dropped. There is no followed users filter
+// since follows do not exist yet.
+func streamFilter(r *http.Request, hidden []uuid.UUID) (func(StreamMessage) bool, error) {
+	var authors []uuid.UUID
+
+	for _, raw := range r.URL.Query()["author_id"] {
+		authorID, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		authors = append(authors, authorID)
+	}
+
+	events := r.URL.Query()["events"]
+
+	for _, event := range events {
+		if !slices.Contains(streamedEvents, event) {
+			return nil, fmt.Errorf("unknown event %s", event)
+		}
+	}
+
+	return func(msg StreamMessage) bool {
+		if slices.Contains(hidden, msg.AuthorID) {
+			return false
+		}
+
+		if len(authors) > 0 && !slices.Contains(authors, msg.AuthorID) {
+			return false
+		}
+
+		return len(events) == 0 || slices.Contains(events, msg.Type)
+	}, nil
+}
+
+func (conf *APIConfig) StreamHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticateStream(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// Blocks and mutes made while connected apply on the next connection.
+	hidden, err := conf.Database.GetHiddenUsers(r.Context(), userID)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	filter, err := streamFilter(r, hidden)
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sub := conf.StreamHub.Subscribe(filter)
+	defer sub.Close()
+
+	controller := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if err := controller.Flush(); err != nil {
+		slog.ErrorContext(r.Context(), "streaming is not supported", "error", err.Error())
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-conf.StreamHub.Done():
+			_, _ = fmt.Fprint(w, "event: error\ndata: {\"error\":\"server is shutting down\"}\n\n")
+			_ = controller.Flush()
+
+			return
+		case <-heartbeat.C:
+			if reason, revoked := conf.streamRevoked(r.Context(), userID); revoked {
+				data, _ := json.Marshal(map[string]string{"error": reason})
+				_, _ = fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+				_ = controller.Flush()
+
+				return
+			}
+
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		case msg, ok := <-sub.C():
+			if !ok {
+				// The hub disconnected the client for falling behind.
+				_, _ = fmt.Fprint(w, "event: error\ndata: {\"error\":\"slow consumer\"}\n\n")
+				_ = controller.Flush()
+
+				return
+			}
+
+			err = writeServerSentEvent(w, msg)
+		}
+
+		if err == nil {
+			err = controller.Flush()
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeServerSentEvent(w http.ResponseWriter, msg StreamMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", msg.ID, msg.Type, data)
+
+	return err
+}
+
+func (conf *APIConfig) StreamWebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticateStream(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// Blocks and mutes made while connected apply on the next connection.
+	hidden, err := conf.Database.GetHiddenUsers(r.Context(), userID)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	filter, err := streamFilter(r, hidden)
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already responded.
+		return
+	}
+	defer conn.Close()
+
+	sub := conf.StreamHub.Subscribe(filter)
+	defer sub.Close()
+
+	// The stream is one-way, reading only notices when the client goes away.
+	closed := make(chan struct{})
+
+	go func() {
+		defer close(closed)
+
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		_ = conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+
+		select {
+		case <-closed:
+			return
+		case <-conf.StreamHub.Done():
+			_ = conn.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down"))
+
+			return
+		case <-heartbeat.C:
+			if reason, revoked := conf.streamRevoked(r.Context(), userID); revoked {
+				_ = conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason))
+
+				return
+			}
+
+			err = conn.WriteMessage(websocket.PingMessage, nil)
+		case msg, ok := <-sub.C():
+			if !ok {
+				_ = conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "slow consumer"))
+
+				return
+			}
+
+			err = conn.WriteJSON(msg)
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mashfeii/chirpy/internal/application/outbox"
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+)
+
+const (
+	PolkaSignatureHeader = "X-Polka-Signature"
+
+	polkaSource       = "polka"
+	webhookTolerance  = 5 * time.Minute
+	maxWebhookPayload = 1 << 20
+
+	// webhookEventProcessed and webhookEventIgnored are final statuses of
+	// received webhook events, the others being received and failed.
+	webhookEventProcessed = "processed"
+	webhookEventIgnored   = "ignored"
+)
+
+var (
+	polkaEvents = []string{UpgradeEvent, DowngradeEvent, CancellationEvent, ExpirationEvent, RefundEvent}
+
+	errDuplicateEvent = errors.New("event has already been processed")
+	errUnknownUser    = errors.New("user not found")
+)
+
+// applyPolkaEvent updates the Chirpy Red membership of userID:
+//   - upgraded starts or renews a membership, lasting until periodEnd if it
+//     is set;
+//   - cancelled keeps the membership until the end of the paid period;
+//   - downgraded, expired and refunded end the membership immediately.
+func applyPolkaEvent(ctx context.Context, q *database.Queries, event string, userID uuid.UUID, periodEnd sql.NullTime) error {
+	var err error
+
+	switch event {
+	case UpgradeEvent:
+		_, err = q.UpgradeUserRedChirp(ctx, database.UpgradeUserRedChirpParams{
+			ID:        userID,
+			RedEndsAt: periodEnd,
+		})
+		if err == nil {
+			err = outbox.Write(ctx, q, UserUpgradedEvent, userID, map[string]string{
+				"user_id": userID.String(),
+			})
+		}
+	case CancellationEvent:
+		_, err = q.CancelUserRedChirp(ctx, database.CancelUserRedChirpParams{
+			ID:     userID,
+			EndsAt: periodEnd,
+		})
+		// Cancelling a membership that has already ended is a no-op.
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil
+		}
+	case DowngradeEvent, ExpirationEvent, RefundEvent:
+		_, err = q.DowngradeUserRedChirp(ctx, userID)
+		if err == nil {
+			err = writeDowngrade(ctx, q, userID)
+		}
+	}
+
+	return err
+}
+
+func writeDowngrade(ctx context.Context, q *database.Queries, userID uuid.UUID) error {
+	return outbox.Write(ctx, q, UserDowngradedEvent, userID, map[string]string{
+		"user_id": userID.String(),
+	})
+}
+
+// ExpireRedMemberships downgrades users whose paid period has ended. It is
+// meant to be run periodically.
+func (conf *APIConfig) ExpireRedMemberships(ctx context.Context) error {
+	var expired []uuid.UUID
+
+	err := conf.Transactor.InTx(ctx, func(q *database.Queries) error {
+		var err error
+
+		expired, err = q.ExpireRedChirpMemberships(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, userID := range expired {
+			if err = writeDowngrade(ctx, q, userID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range expired {
+		slog.InfoContext(ctx, "chirpy red membership expired", "user_id", userID.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/mashfeii/chirpy/internal/application/outbox"
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+	stringshelpers "github.com/mashfeii/chirpy/pkg/strings_helpers"
+)
+
+type Tier string
+
+// TierCacheTTL bounds how long rate limits lag behind tier changes when the
+// user event that invalidates the cache is missed.
+const TierCacheTTL = time.Minute
+
+const (
+	TierFree Tier = "free"
+	TierRed  Tier = "red"
+)
+
+// Entitlements lists what a tier is allowed to do. Handlers consult it
+// instead of hard-coding limits.
+type Entitlements struct {
+	MaxChirpLength      int
+	EditChirps          bool
+	ScheduleChirps      bool
+	RateLimitMultiplier int
+}
+
+var TierEntitlements = map[Tier]Entitlements{
+	TierFree: {
+		MaxChirpLength:      140,
+		EditChirps:          false,
+		ScheduleChirps:      false,
+		RateLimitMultiplier: 1,
+	},
+	TierRed: {
+		MaxChirpLength:      500,
+		EditChirps:          true,
+		ScheduleChirps:      true,
+		RateLimitMultiplier: 5,
+	},
+}
+
+var profaneWords = []string{"kerfuffle", "sharbert", "fornax"}
+
+func TierOf(user database.User) Tier {
+	if user.IsChirpyRed {
+		return TierRed
+	}
+
+	return TierFree
+}
+
+// InvalidateUserCaches drops what is cached about the user of user events.
+// It is subscribed to the bus, so it runs on every replica.
+func (conf *APIConfig) InvalidateUserCaches(event outbox.Event) {
+	if strings.HasPrefix(event.Type, "user.") {
+		conf.TierCache.Delete(event.UserID)
+	}
+}
+
+func (conf *APIConfig) entitlements(ctx context.Context, userID uuid.UUID) (Entitlements, error) {
+	user, err := conf.Database.GetUserByID(ctx, userID)
+	if err != nil {
+		return Entitlements{}, err
+	}
+
+	return TierEntitlements[TierOf(user)], nil
+}
+
+// cleanChirpBody validates body against the author's entitlements and masks
+// profane words.
+func cleanChirpBody(body string, entitlements Entitlements) (string, error) {
+	if utf8.RuneCountInString(body) > entitlements.MaxChirpLength {
+		return "", fmt.Errorf("chirp is too long, the limit is %d characters", entitlements.MaxChirpLength)
+	}
+
+	return stringshelpers.CleanString(body, profaneWords), nil
+}
@@ -1,18 +1,56 @@
 package domain
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/mashfeii/chirpy/pkg/entities"
 )
 
+const uniqueViolation = "23505"
+
+// usernamePattern matches the handles that entities.Parse finds in mentions.
+var usernamePattern = regexp.MustCompile(fmt.Sprintf(`^[a-z0-9_]{3,%d}$`, entities.MaxHandleLength))
+
+// User is the private view of a user, only returned to the user itself. Use
+// Profile anywhere else.
 type User struct {
 	ID             uuid.UUID `json:"id"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 	Email          string    `json:"email"`
+	Username       string    `json:"username,omitempty"`
 	HashedPassword string    `json:"hashed_password,omitempty"`
 	Token          string    `json:"token,omitempty"`
 	RefreshToken   string    `json:"refresh_token,omitempty"`
 	IsChirpyRed    bool      `json:"is_chirpy_red,omitempty"`
 }
+
+// parseUsername lowercases username and validates it. An empty username is
+// returned as NULL.
+func parseUsername(username string) (sql.NullString, error) {
+	if username == "" {
+		return sql.NullString{}, nil
+	}
+
+	username = strings.ToLower(username)
+
+	if !usernamePattern.MatchString(username) {
+		return sql.NullString{}, fmt.Errorf("username must be 3 to %d letters, digits or underscores", entities.MaxHandleLength)
+	}
+
+	return sql.NullString{String: username, Valid: true}, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
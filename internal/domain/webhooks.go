@@ -0,0 +1,375 @@
+package domain
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"github.com/mashfeii/chirpy/internal/application/outbox"
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+	"github.com/mashfeii/chirpy/pkg/webhook"
+)
+
+const (
+	ChirpCreatedEvent = "chirp.created"
+	ChirpDeletedEvent = "chirp.deleted"
+	UserCreatedEvent  = "user.created"
+	UserUpdatedEvent  = "user.updated"
+	UserUpgradedEvent = "user.upgraded"
+	// UserDowngradedEvent is sent when a Chirpy Red membership ends.
+	UserDowngradedEvent = "user.downgraded"
+	// UserStateChangedEvent is sent when a moderator suspends, unsuspends,
+	// deactivates or reactivates a user. It is not subscribable.
+	UserStateChangedEvent = "user.state_changed"
+
+	deliveryPending = "pending"
+	deliveryDead    = "dead"
+
+	// WebhookTimeout bounds a single delivery.
+	WebhookTimeout = 10 * time.Second
+
+	maxDeliveryAttempts = 10
+	deliveryBatchSize   = 10
+	deliveryLogSize     = 100
+)
+
+var subscribableEvents = []string{
+	ChirpCreatedEvent, ChirpDeletedEvent, UserCreatedEvent, UserUpdatedEvent, UserUpgradedEvent, UserDowngradedEvent,
+}
+
+type WebhookEndpoint struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Global    bool      `json:"global"`
+	Secret    string    `json:"secret,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Event          string    `json:"event"`
+	Status         string    `json:"status"`
+	Attempts       int32     `json:"attempts"`
+	NextAttemptAt  time.Time `json:"next_attempt_at"`
+	LastStatusCode int32     `json:"last_status_code,omitempty"`
+	LastError      string    `json:"last_error,omitempty"`
+}
+
+func webhookEndpointFromDB(endpoint database.WebhookEndpoint) WebhookEndpoint {
+	return WebhookEndpoint{
+		ID:        endpoint.ID,
+		CreatedAt: endpoint.CreatedAt,
+		URL:       endpoint.Url,
+		Events:    endpoint.Events,
+		Global:    endpoint.IsGlobal,
+	}
+}
+
+func webhookDeliveryFromDB(delivery database.WebhookDelivery) WebhookDelivery {
+	return WebhookDelivery{
+		ID:             delivery.ID,
+		CreatedAt:      delivery.CreatedAt,
+		UpdatedAt:      delivery.UpdatedAt,
+		Event:          delivery.EventType,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		NextAttemptAt:  delivery.NextAttemptAt,
+		LastStatusCode: delivery.LastStatusCode.Int32,
+		LastError:      delivery.LastError.String,
+	}
+}
+
+func makeWebhookSecret() string {
+	buffer := make([]byte, 32)
+
+	_, _ = rand.Read(buffer)
+
+	return "whsec_" + hex.EncodeToString(buffer)
+}
+
+// QueueWebhookDeliveries is an outbox sink that queues a delivery of the
+// event for every endpoint subscribed to it: endpoints of the user the event
+// is about and global ones.
+func (conf *APIConfig) QueueWebhookDeliveries(ctx context.Context, q *database.Queries, event outbox.Event) error {
+	endpoints, err := q.GetWebhookEndpointsForEvent(ctx, database.GetWebhookEndpointsForEventParams{
+		Event:  event.Type,
+		UserID: event.UserID,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, endpoint := range endpoints {
+		err = q.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{
+			EndpointID: endpoint.ID,
+			EventType:  event.Type,
+			Payload:    string(event.Payload),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeliverWebhooks sends the deliveries that are due. Failed deliveries are
+// retried with exponential backoff and dead-lettered after
+// maxDeliveryAttempts attempts. It is meant to be run periodically.
+func (conf *APIConfig) DeliverWebhooks(ctx context.Context) error {
+	// Deliveries are sent one after the other, so the lease must outlast the
+	// whole batch or another replica would claim them again.
+	deliveries, err := conf.Database.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+		LeasedUntil: time.Now().Add(deliveryBatchSize*WebhookTimeout + time.Minute),
+		Limit:       deliveryBatchSize,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		sendCtx, cancel := context.WithTimeout(ctx, WebhookTimeout)
+
+		status, sendErr := conf.WebhookSender.Send(sendCtx, webhook.Delivery{
+			ID:      delivery.ID.String(),
+			Event:   delivery.EventType,
+			URL:     delivery.Url,
+			Secret:  delivery.Secret,
+			Payload: []byte(delivery.Payload),
+		})
+
+		cancel()
+
+		statusCode := sql.NullInt32{Int32: int32(status), Valid: status != 0}
+
+		if sendErr == nil {
+			err = conf.Database.MarkWebhookDeliverySucceeded(ctx, database.MarkWebhookDeliverySucceededParams{
+				ID:             delivery.ID,
+				LastStatusCode: statusCode,
+			})
+		} else {
+			attempts := int(delivery.Attempts) + 1
+			state := deliveryPending
+
+			if attempts >= maxDeliveryAttempts {
+				state = deliveryDead
+			}
+
+			err = conf.Database.MarkWebhookDeliveryFailed(ctx, database.MarkWebhookDeliveryFailedParams{
+				ID:             delivery.ID,
+				Status:         state,
+				NextAttemptAt:  time.Now().Add(webhook.Backoff(attempts)),
+				LastStatusCode: statusCode,
+				LastError:      sql.NullString{String: sendErr.Error(), Valid: true},
+			})
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (conf *APIConfig) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Global bool     `json:"global"`
+	}
+
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+
+	var params parameters
+
+	if err = decoder.Decode(&params); err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	target, err := url.Parse(params.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		errorRespond(w, r, http.StatusBadRequest, "url must be an absolute http(s) URL")
+		return
+	}
+
+	// Hostnames are checked again once resolved, when deliveries are sent.
+	if addr, err := netip.ParseAddr(target.Hostname()); (err == nil && !webhook.IsPublicAddr(addr)) ||
+		strings.EqualFold(target.Hostname(), "localhost") {
+		errorRespond(w, r, http.StatusBadRequest, "url must point to a public address")
+		return
+	}
+
+	if len(params.Events) == 0 {
+		errorRespond(w, r, http.StatusBadRequest, "at least one event is required")
+		return
+	}
+
+	for _, event := range params.Events {
+		if !slices.Contains(subscribableEvents, event) {
+			errorRespond(w, r, http.StatusBadRequest, "unknown event "+event)
+			return
+		}
+	}
+
+	if params.Global {
+		user, err := conf.Database.GetUserByID(r.Context(), userID)
+		if err != nil {
+			errorRespond(w, r, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		if !user.IsAdmin {
+			errorRespond(w, r, http.StatusForbidden, "only admins can subscribe to events of every user")
+			return
+		}
+	}
+
+	endpoint, err := conf.Database.CreateWebhookEndpoint(r.Context(), database.CreateWebhookEndpointParams{
+		UserID:   userID,
+		Url:      target.String(),
+		Secret:   makeWebhookSecret(),
+		Events:   lo.Uniq(params.Events),
+		IsGlobal: params.Global,
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// The secret is only ever returned on creation.
+	response := webhookEndpointFromDB(endpoint)
+	response.Secret = endpoint.Secret
+
+	successRespond(w, r, http.StatusCreated, response)
+}
+
+func (conf *APIConfig) ShowWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	endpoints, err := conf.Database.GetWebhookEndpointsByUser(r.Context(), userID)
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, lo.Map(endpoints, func(endpoint database.WebhookEndpoint, _ int) WebhookEndpoint {
+		return webhookEndpointFromDB(endpoint)
+	}))
+}
+
+// ownedWebhook loads the endpoint from the webhook_id path value and checks
+// that it belongs to the authenticated user.
+func (conf *APIConfig) ownedWebhook(w http.ResponseWriter, r *http.Request) (database.WebhookEndpoint, bool) {
+	userID, err := conf.authenticate(r)
+	if err != nil {
+		errorRespond(w, r, http.StatusUnauthorized, err.Error())
+		return database.WebhookEndpoint{}, false
+	}
+
+	endpointID, err := uuid.Parse(r.PathValue("webhook_id"))
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return database.WebhookEndpoint{}, false
+	}
+
+	endpoint, err := conf.Database.GetWebhookEndpoint(r.Context(), endpointID)
+	if err != nil {
+		errorRespond(w, r, http.StatusNotFound, err.Error())
+		return database.WebhookEndpoint{}, false
+	}
+
+	if endpoint.UserID != userID {
+		errorRespond(w, r, http.StatusForbidden, "user does not own webhook")
+		return database.WebhookEndpoint{}, false
+	}
+
+	return endpoint, true
+}
+
+func (conf *APIConfig) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := conf.ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if err := conf.Database.DeleteWebhookEndpoint(r.Context(), endpoint.ID); err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusNoContent, nil)
+}
+
+func (conf *APIConfig) ShowWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := conf.ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := conf.Database.GetWebhookDeliveries(r.Context(), database.GetWebhookDeliveriesParams{
+		EndpointID: endpoint.ID,
+		Limit:      deliveryLogSize,
+	})
+	if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, lo.Map(deliveries, func(delivery database.WebhookDelivery, _ int) WebhookDelivery {
+		return webhookDeliveryFromDB(delivery)
+	}))
+}
+
+func (conf *APIConfig) RetryWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := conf.ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := uuid.Parse(r.PathValue("delivery_id"))
+	if err != nil {
+		errorRespond(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	delivery, err := conf.Database.RetryWebhookDelivery(r.Context(), database.RetryWebhookDeliveryParams{
+		ID:         deliveryID,
+		EndpointID: endpoint.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		errorRespond(w, r, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		errorRespond(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	successRespond(w, r, http.StatusOK, webhookDeliveryFromDB(delivery))
+}
@@ -1,9 +1,15 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// HealthHandler reports liveness: the process is up and serving requests.
 func HealthHandler(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(200)
@@ -13,3 +19,109 @@ func HealthHandler(w http.ResponseWriter, _ *http.Request) {
 		panic(err)
 	}
 }
+
+const (
+	checkOK    = "ok"
+	checkError = "error"
+)
+
+type ReadinessCheck func(ctx context.Context) error
+
+// Notice is returned by checks that pass but have something to report. It
+// is shown as the detail of the check.
+type Notice string
+
+func (n Notice) Error() string {
+	return string(n)
+}
+
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type ReadinessReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Readiness reports whether the instance should receive traffic: every
+// registered dependency check passes and the server is not shutting down.
+type Readiness struct {
+	timeout  time.Duration
+	names    []string
+	checks   []ReadinessCheck
+	draining atomic.Bool
+}
+
+func NewReadiness(timeout time.Duration) *Readiness {
+	return &Readiness{timeout: timeout}
+}
+
+func (rd *Readiness) AddCheck(name string, check ReadinessCheck) {
+	rd.names = append(rd.names, name)
+	rd.checks = append(rd.checks, check)
+}
+
+// SetDraining makes every following readiness probe fail, so load balancers
+// stop routing to the instance before it shuts down.
+func (rd *Readiness) SetDraining() {
+	rd.draining.Store(true)
+}
+
+func (rd *Readiness) Handler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), rd.timeout)
+	defer cancel()
+
+	report := ReadinessReport{
+		Status: checkOK,
+		Checks: make(map[string]CheckResult, len(rd.checks)+1),
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	for i, check := range rd.checks {
+		wg.Add(1)
+
+		go func(name string, check ReadinessCheck) {
+			defer wg.Done()
+
+			var notice Notice
+
+			result := CheckResult{Status: checkOK}
+			if err := check(ctx); errors.As(err, &notice) {
+				result.Detail = notice.Error()
+			} else if err != nil {
+				result = CheckResult{Status: checkError, Error: err.Error()}
+			}
+
+			mu.Lock()
+			report.Checks[name] = result
+			mu.Unlock()
+		}(rd.names[i], check)
+	}
+
+	wg.Wait()
+
+	report.Checks["draining"] = CheckResult{Status: checkOK}
+	if rd.draining.Load() {
+		report.Checks["draining"] = CheckResult{Status: checkError, Error: "server is shutting down"}
+	}
+
+	code := http.StatusOK
+
+	for _, result := range report.Checks {
+		if result.Status != checkOK {
+			report.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+		}
+	}
+
+	if err := RespondWithJSON(w, code, report); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
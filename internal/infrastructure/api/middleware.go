@@ -1,13 +1,198 @@
 package api
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mashfeii/chirpy/internal/infrastructure/logging"
+	"github.com/mashfeii/chirpy/pkg/ratelimit"
 )
 
+const RequestIDHeader = "X-Request-ID"
+
+// MiddlewareLog assigns a request ID to every request, stores it in the
+// request context and logs the outcome once the request has been served.
 func MiddlewareLog(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%s\t%s", r.Method, r.URL.Path)
+		start := time.Now()
+
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" || len(requestID) > 128 {
+			requestID = uuid.NewString()
+		}
+
+		w.Header().Set(RequestIDHeader, requestID)
+
+		ctx := logging.WithRequestID(r.Context(), requestID)
+		sw := NewStatusWriter(w)
+
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		slog.InfoContext(ctx, "request served",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", sw.Status),
+			slog.Int("bytes", sw.Bytes),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote_ip", ClientIP(r)),
+		)
+	})
+}
+
+// MiddlewareRateLimit counts every request against the bucket and limit
+// returned by resolve and rejects it with 429 once the bucket is empty. If
+// the store fails, requests are let through rather than taking the route down.
+func MiddlewareRateLimit(
+	store ratelimit.Store,
+	resolve func(*http.Request) (string, ratelimit.Limit),
+	next http.Handler,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, limit := resolve(r)
+
+		result, err := store.Take(r.Context(), key, limit)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "rate limiter unavailable", "error", err.Error())
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+
+		if !result.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+
+			if err := RespondWithError(w, http.StatusTooManyRequests, "rate limit exceeded"); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			return
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+type clientIPKey struct{}
+
+// ParseTrustedProxies reads addresses and CIDR prefixes separated by commas.
+func ParseTrustedProxies(raw string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, err
+			}
+
+			prefixes = append(prefixes, prefix.Masked())
+
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q is neither an address nor a prefix", entry)
+		}
+
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+
+	return prefixes, nil
+}
+
+// MiddlewareClientIP resolves the client address once for ClientIP. Requests
+// from trusted proxies are attributed to the right-most X-Forwarded-For hop
+// that is not a trusted proxy itself, since hops further left are set by the
+// client. It has to wrap every middleware that calls ClientIP.
+func MiddlewareClientIP(trusted []netip.Prefix, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientIPKey{}, forwardedClientIP(r, trusted))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func forwardedClientIP(r *http.Request, trusted []netip.Prefix) string {
+	ip := peerIP(r)
+
+	if !isTrustedProxy(ip, trusted) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+
+		ip = hop
+
+		if !isTrustedProxy(hop, trusted) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func isTrustedProxy(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ClientIP returns the address of the client that sent the request, as
+// resolved by MiddlewareClientIP, or of the peer otherwise.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+
+	return peerIP(r)
+}
+
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// StatusWriter wraps http.ResponseWriter and remembers the status code and
+// the amount of bytes written, so middlewares can report them afterwards.
+type StatusWriter struct {
+	http.ResponseWriter
+	Status int
+	Bytes  int
+}
+
+func NewStatusWriter(w http.ResponseWriter) *StatusWriter {
+	return &StatusWriter{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (w *StatusWriter) WriteHeader(code int) {
+	w.Status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *StatusWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.Bytes += n
+
+	return n, err
+}
+
+func (w *StatusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush and Hijack are forwarded for streaming responses and WebSocket
+// upgrades, whose libraries look for the interfaces directly.
+func (w *StatusWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *StatusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.Status = http.StatusSwitchingProtocols
+
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
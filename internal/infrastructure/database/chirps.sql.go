@@ -7,23 +7,43 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const countChirpsByUser = `-- name: CountChirpsByUser :one
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1 AND published AND hidden_at IS NULL
+`
+
+func (q *Queries) CountChirpsByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChirpsByUser, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps(id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, body, user_id
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, publish_at, published)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4)
+RETURNING id, created_at, updated_at, body, user_id, publish_at, published, hidden_at
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	PublishAt sql.NullTime
+	Published bool
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.PublishAt,
+		arg.Published,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -31,6 +51,9 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.PublishAt,
+		&i.Published,
+		&i.HiddenAt,
 	)
 	return i, err
 }
@@ -45,8 +68,59 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteScheduledChirp = `-- name: DeleteScheduledChirp :execrows
+DELETE FROM chirps
+WHERE id = $1 AND NOT published
+`
+
+func (q *Queries) DeleteScheduledChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteScheduledChirp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getAllChirpsByUser = `-- name: GetAllChirpsByUser :many
+SELECT id, created_at, updated_at, body, user_id, publish_at, published, hidden_at FROM chirps
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetAllChirpsByUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getAllChirpsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.PublishAt,
+			&i.Published,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, publish_at, published, hidden_at FROM chirps
 WHERE id = $1
 `
 
@@ -59,17 +133,34 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.PublishAt,
+		&i.Published,
+		&i.HiddenAt,
 	)
 	return i, err
 }
 
 const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, publish_at, published, hidden_at FROM chirps
+WHERE ((published AND hidden_at IS NULL) OR user_id = $1)
+  AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = $1 AND blocked_id = chirps.user_id)
+      OR (blocker_id = chirps.user_id AND blocked_id = $1)
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE muter_id = $1 AND muted_id = chirps.user_id
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM users
+    WHERE users.id = chirps.user_id AND users.deactivated_at IS NOT NULL
+  )
 ORDER BY created_at
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+func (q *Queries) GetChirps(ctx context.Context, viewerID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirps, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -83,6 +174,9 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.PublishAt,
+			&i.Published,
+			&i.HiddenAt,
 		); err != nil {
 			return nil, err
 		}
@@ -98,13 +192,28 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpsByUser = `-- name: GetChirpsByUser :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, publish_at, published, hidden_at FROM chirps
 WHERE user_id = $1
+  AND ((published AND hidden_at IS NULL) OR user_id = $2)
+  AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = $2 AND blocked_id = chirps.user_id)
+      OR (blocker_id = chirps.user_id AND blocked_id = $2)
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM users
+    WHERE users.id = chirps.user_id AND users.deactivated_at IS NOT NULL
+  )
 ORDER BY created_at
 `
 
-func (q *Queries) GetChirpsByUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByUser, userID)
+type GetChirpsByUserParams struct {
+	UserID   uuid.UUID
+	ViewerID uuid.UUID
+}
+
+func (q *Queries) GetChirpsByUser(ctx context.Context, arg GetChirpsByUserParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByUser, arg.UserID, arg.ViewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -118,6 +227,9 @@ func (q *Queries) GetChirpsByUser(ctx context.Context, userID uuid.UUID) ([]Chir
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.PublishAt,
+			&i.Published,
+			&i.HiddenAt,
 		); err != nil {
 			return nil, err
 		}
@@ -131,3 +243,166 @@ func (q *Queries) GetChirpsByUser(ctx context.Context, userID uuid.UUID) ([]Chir
 	}
 	return items, nil
 }
+
+const getScheduledChirpsByUser = `-- name: GetScheduledChirpsByUser :many
+SELECT id, created_at, updated_at, body, user_id, publish_at, published, hidden_at FROM chirps
+WHERE user_id = $1 AND NOT published
+ORDER BY publish_at
+`
+
+func (q *Queries) GetScheduledChirpsByUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getScheduledChirpsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.PublishAt,
+			&i.Published,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const hideChirp = `-- name: HideChirp :execrows
+UPDATE chirps
+SET hidden_at = NOW()
+WHERE id = $1 AND hidden_at IS NULL
+`
+
+func (q *Queries) HideChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, hideChirp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const publishDueChirps = `-- name: PublishDueChirps :many
+UPDATE chirps
+SET published = TRUE, created_at = NOW(), updated_at = NOW()
+WHERE id IN (
+  SELECT id FROM chirps
+  WHERE NOT published AND publish_at <= NOW()
+    AND NOT EXISTS (
+      SELECT 1 FROM users
+      WHERE users.id = chirps.user_id AND users.deactivated_at IS NOT NULL
+    )
+    AND NOT EXISTS (
+      SELECT 1 FROM user_suspensions
+      WHERE user_suspensions.user_id = chirps.user_id AND lifted_at IS NULL
+        AND (expires_at IS NULL OR expires_at > NOW())
+    )
+  ORDER BY publish_at
+  LIMIT $1
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, body, user_id, publish_at, published, hidden_at
+`
+
+func (q *Queries) PublishDueChirps(ctx context.Context, limit int32) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, publishDueChirps, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.PublishAt,
+			&i.Published,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateChirp = `-- name: UpdateChirp :one
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, publish_at, published, hidden_at
+`
+
+type UpdateChirpParams struct {
+	ID   uuid.UUID
+	Body string
+}
+
+func (q *Queries) UpdateChirp(ctx context.Context, arg UpdateChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirp, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.PublishAt,
+		&i.Published,
+		&i.HiddenAt,
+	)
+	return i, err
+}
+
+const updateScheduledChirp = `-- name: UpdateScheduledChirp :one
+UPDATE chirps
+SET body = $2, publish_at = $3, updated_at = NOW()
+WHERE id = $1 AND NOT published
+RETURNING id, created_at, updated_at, body, user_id, publish_at, published, hidden_at
+`
+
+type UpdateScheduledChirpParams struct {
+	ID        uuid.UUID
+	Body      string
+	PublishAt sql.NullTime
+}
+
+func (q *Queries) UpdateScheduledChirp(ctx context.Context, arg UpdateScheduledChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateScheduledChirp, arg.ID, arg.Body, arg.PublishAt)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.PublishAt,
+		&i.Published,
+		&i.HiddenAt,
+	)
+	return i, err
+}
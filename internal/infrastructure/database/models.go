@@ -17,6 +17,134 @@ type Chirp struct {
 	UpdatedAt time.Time
 	Body      string
 	UserID    uuid.UUID
+	PublishAt sql.NullTime
+	Published bool
+	HiddenAt  sql.NullTime
+}
+
+type ChirpHashtag struct {
+	ChirpID uuid.UUID
+	Tag     string
+}
+
+type ChirpMention struct {
+	ChirpID uuid.UUID
+	UserID  uuid.UUID
+	Handle  string
+}
+
+type Conversation struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	IsGroup   bool
+	DirectKey sql.NullString
+}
+
+type ConversationParticipant struct {
+	ConversationID uuid.UUID
+	UserID         uuid.UUID
+	JoinedAt       time.Time
+	LastReadAt     sql.NullTime
+}
+
+type DailyStat struct {
+	Day    time.Time
+	Metric string
+	Count  int64
+}
+
+type DataExport struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	Status     string
+	StorageKey sql.NullString
+	LastError  sql.NullString
+	ExpiresAt  sql.NullTime
+}
+
+type Draft struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+}
+
+type MediaFile struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UserID      uuid.UUID
+	ChirpID     uuid.NullUUID
+	StorageKey  string
+	ContentType string
+	SizeBytes   int64
+	Width       int32
+	Height      int32
+	Status      string
+	UpdatedAt   time.Time
+	LastError   sql.NullString
+}
+
+type MediaVariant struct {
+	MediaFileID uuid.UUID
+	Name        string
+	StorageKey  string
+	ContentType string
+	Width       int32
+	Height      int32
+}
+
+type Message struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	ConversationID uuid.UUID
+	SenderID       uuid.UUID
+	Body           string
+}
+
+type ModerationAction struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	ModeratorID  uuid.UUID
+	Action       string
+	ReportID     uuid.NullUUID
+	ChirpID      uuid.NullUUID
+	TargetUserID uuid.NullUUID
+	Note         string
+}
+
+type Notification struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	Type       string
+	ChirpID    uuid.NullUUID
+	ActorIds   []uuid.UUID
+	ActorCount int32
+	ReadAt     sql.NullTime
+	GroupKey   string
+}
+
+type Outbox struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	EventType   string
+	UserID      uuid.UUID
+	Payload     string
+	Attempts    int32
+	AvailableAt time.Time
+	PublishedAt sql.NullTime
+	LastError   sql.NullString
+}
+
+type OutboxDelivery struct {
+	EventID     uuid.UUID
+	Sink        string
+	DeliveredAt time.Time
 }
 
 type RefreshToken struct {
@@ -28,11 +156,91 @@ type RefreshToken struct {
 	UserID    uuid.UUID
 }
 
+type Report struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	ChirpID        uuid.NullUUID
+	ReportedUserID uuid.UUID
+	ReporterID     uuid.UUID
+	Reason         string
+	Details        string
+	Status         string
+	AssigneeID     uuid.NullUUID
+	Resolution     sql.NullString
+	ResolvedAt     sql.NullTime
+}
+
 type User struct {
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Email               string
+	HashedPassword      string
+	IsChirpyRed         bool
+	IsAdmin             bool
+	RedStartedAt        sql.NullTime
+	RedEndsAt           sql.NullTime
+	Username            sql.NullString
+	DisplayName         string
+	Bio                 string
+	AvatarMediaID       uuid.NullUUID
+	DeactivatedAt       sql.NullTime
+	DeletionScheduledAt sql.NullTime
+}
+
+type UserBlock struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
+type UserMute struct {
+	MuterID   uuid.UUID
+	MutedID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type UserSuspension struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Reason    string
+	ExpiresAt sql.NullTime
+	LiftedAt  sql.NullTime
+}
+
+type WebhookDelivery struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	EndpointID     uuid.UUID
+	EventType      string
+	Payload        string
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastStatusCode sql.NullInt32
+	LastError      sql.NullString
+}
+
+type WebhookEndpoint struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Url       string
+	Secret    string
+	Events    []string
+	IsGlobal  bool
+}
+
+type WebhookEvent struct {
+	ID          string
+	Source      string
+	EventType   string
+	Payload     string
+	ReceivedAt  time.Time
+	Status      string
+	ProcessedAt sql.NullTime
+	LastError   sql.NullString
 }
@@ -0,0 +1,17 @@
+package database
+
+import "strings"
+
+// QueryName extracts the query name from the "-- name: X :kind" header that
+// sqlc prepends to every generated statement.
+func QueryName(query string) string {
+	const prefix = "-- name: "
+
+	if !strings.HasPrefix(query, prefix) {
+		return "unknown"
+	}
+
+	name, _, _ := strings.Cut(strings.TrimPrefix(query, prefix), " ")
+
+	return name
+}
@@ -13,6 +13,18 @@ import (
 	"github.com/google/uuid"
 )
 
+const countActiveRefreshTokens = `-- name: CountActiveRefreshTokens :one
+SELECT COUNT(*) FROM refresh_tokens
+WHERE revoked_at IS NULL AND expires_at > NOW()
+`
+
+func (q *Queries) CountActiveRefreshTokens(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countActiveRefreshTokens)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const getRefreshToken = `-- name: GetRefreshToken :one
 SELECT token, created_at, updated_at, expires_at, revoked_at, user_id FROM refresh_tokens WHERE token = $1 LIMIT 1
 `
@@ -31,6 +43,42 @@ func (q *Queries) GetRefreshToken(ctx context.Context, token string) (RefreshTok
 	return i, err
 }
 
+const getRefreshTokensByUser = `-- name: GetRefreshTokensByUser :many
+SELECT token, created_at, updated_at, expires_at, revoked_at, user_id FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetRefreshTokensByUser(ctx context.Context, userID uuid.UUID) ([]RefreshToken, error) {
+	rows, err := q.db.QueryContext(ctx, getRefreshTokensByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RefreshToken
+	for rows.Next() {
+		var i RefreshToken
+		if err := rows.Scan(
+			&i.Token,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const insertRefreshToken = `-- name: InsertRefreshToken :one
 INSERT INTO refresh_tokens (token, created_at, updated_at, expires_at, revoked_at, user_id)
 VALUES ($1, NOW(), NOW(), $2, $3, $4)
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// SchemaVersion is the goose version of the latest migration in sql/schema.
+// It has to be bumped together with every new migration.
+const SchemaVersion = 25
+
+const currentSchemaVersion = `SELECT version_id FROM goose_db_version
+WHERE is_applied
+ORDER BY id DESC
+LIMIT 1`
+
+// ErrSchemaAhead is returned by CheckSchemaVersion when the database has been
+// migrated past SchemaVersion, as happens to old replicas during a rolling
+// deploy. Migrations are expected to stay compatible with the previous
+// release, so it is not a failure.
+var ErrSchemaAhead = errors.New("database schema is ahead")
+
+// CheckSchemaVersion verifies that the database has been migrated to at
+// least SchemaVersion.
+func CheckSchemaVersion(ctx context.Context, db DBTX) error {
+	var version int64
+
+	if err := db.QueryRowContext(ctx, currentSchemaVersion).Scan(&version); err != nil {
+		return fmt.Errorf("unable to read migration version: %w", err)
+	}
+
+	if version < SchemaVersion {
+		return fmt.Errorf("database is at migration %d, expected %d", version, SchemaVersion)
+	}
+
+	if version > SchemaVersion {
+		return fmt.Errorf("%w: database is at migration %d, expected %d", ErrSchemaAhead, version, SchemaVersion)
+	}
+
+	return nil
+}
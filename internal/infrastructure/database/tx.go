@@ -0,0 +1,32 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// Transactor runs functions inside a transaction. The Queries it hands out
+// go through the same DBTX wrappers as the rest of the application.
+type Transactor struct {
+	db   *sql.DB
+	wrap func(DBTX) DBTX
+}
+
+func NewTransactor(db *sql.DB, wrap func(DBTX) DBTX) *Transactor {
+	return &Transactor{db: db, wrap: wrap}
+}
+
+// InTx commits the transaction if fn succeeds and rolls it back otherwise.
+func (t *Transactor) InTx(ctx context.Context, fn func(q *Queries) error) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(New(t.wrap(tx))); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
@@ -7,23 +7,74 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const cancelUserDeletion = `-- name: CancelUserDeletion :execrows
+UPDATE users
+SET deletion_scheduled_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deletion_scheduled_at > NOW()
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelUserDeletion, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const cancelUserRedChirp = `-- name: CancelUserRedChirp :one
+UPDATE users
+SET red_ends_at = COALESCE($2, red_ends_at, NOW()), updated_at = NOW()
+WHERE id = $1 AND is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, red_started_at, red_ends_at, username, display_name, bio, avatar_media_id, deactivated_at, deletion_scheduled_at
+`
+
+type CancelUserRedChirpParams struct {
+	ID     uuid.UUID
+	EndsAt sql.NullTime
+}
+
+func (q *Queries) CancelUserRedChirp(ctx context.Context, arg CancelUserRedChirpParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, cancelUserRedChirp, arg.ID, arg.EndsAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsAdmin,
+		&i.RedStartedAt,
+		&i.RedEndsAt,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeactivatedAt,
+		&i.DeletionScheduledAt,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
-INSERT INTO users(id, created_at, updated_at, email, hashed_password)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+INSERT INTO users(id, created_at, updated_at, email, hashed_password, username)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3)
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, red_started_at, red_ends_at, username, display_name, bio, avatar_media_id, deactivated_at, deletion_scheduled_at
 `
 
 type CreateUserParams struct {
 	Email          string
 	HashedPassword string
+	Username       sql.NullString
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword, arg.Username)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -32,10 +83,46 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.IsAdmin,
+		&i.RedStartedAt,
+		&i.RedEndsAt,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeactivatedAt,
+		&i.DeletionScheduledAt,
 	)
 	return i, err
 }
 
+const deactivateUser = `-- name: DeactivateUser :execrows
+UPDATE users
+SET deactivated_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND deactivated_at IS NULL
+`
+
+func (q *Queries) DeactivateUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deactivateUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteUser = `-- name: DeleteUser :execrows
+DELETE FROM users
+WHERE id = $1 AND deletion_scheduled_at <= NOW()
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const deleteUsers = `-- name: DeleteUsers :exec
 DELETE FROM users
 `
@@ -45,8 +132,68 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 	return err
 }
 
+const downgradeUserRedChirp = `-- name: DowngradeUserRedChirp :one
+UPDATE users
+SET is_chirpy_red = false, red_ends_at = NOW(), updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, red_started_at, red_ends_at, username, display_name, bio, avatar_media_id, deactivated_at, deletion_scheduled_at
+`
+
+func (q *Queries) DowngradeUserRedChirp(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, downgradeUserRedChirp, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsAdmin,
+		&i.RedStartedAt,
+		&i.RedEndsAt,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeactivatedAt,
+		&i.DeletionScheduledAt,
+	)
+	return i, err
+}
+
+const expireRedChirpMemberships = `-- name: ExpireRedChirpMemberships :many
+UPDATE users
+SET is_chirpy_red = false, updated_at = NOW()
+WHERE is_chirpy_red AND red_ends_at <= NOW()
+RETURNING id
+`
+
+func (q *Queries) ExpireRedChirpMemberships(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, expireRedChirpMemberships)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, red_started_at, red_ends_at, username, display_name, bio, avatar_media_id, deactivated_at, deletion_scheduled_at FROM users
 WHERE email = $1
 `
 
@@ -60,12 +207,21 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.IsAdmin,
+		&i.RedStartedAt,
+		&i.RedEndsAt,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeactivatedAt,
+		&i.DeletionScheduledAt,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, red_started_at, red_ends_at, username, display_name, bio, avatar_media_id, deactivated_at, deletion_scheduled_at FROM users
 WHERE id = $1
 `
 
@@ -79,25 +235,147 @@ func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.IsAdmin,
+		&i.RedStartedAt,
+		&i.RedEndsAt,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeactivatedAt,
+		&i.DeletionScheduledAt,
+	)
+	return i, err
+}
+
+const getUserByUsername = `-- name: GetUserByUsername :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, red_started_at, red_ends_at, username, display_name, bio, avatar_media_id, deactivated_at, deletion_scheduled_at FROM users
+WHERE username = $1
+`
+
+func (q *Queries) GetUserByUsername(ctx context.Context, username sql.NullString) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByUsername, username)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsAdmin,
+		&i.RedStartedAt,
+		&i.RedEndsAt,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeactivatedAt,
+		&i.DeletionScheduledAt,
+	)
+	return i, err
+}
+
+const getUsersDueForDeletion = `-- name: GetUsersDueForDeletion :many
+SELECT id FROM users
+WHERE deletion_scheduled_at <= NOW()
+ORDER BY deletion_scheduled_at
+LIMIT $1
+`
+
+func (q *Queries) GetUsersDueForDeletion(ctx context.Context, limit int32) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersDueForDeletion, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const reactivateUser = `-- name: ReactivateUser :execrows
+UPDATE users
+SET deactivated_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deactivated_at IS NOT NULL
+`
+
+func (q *Queries) ReactivateUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, reactivateUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :one
+UPDATE users
+SET deletion_scheduled_at = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, red_started_at, red_ends_at, username, display_name, bio, avatar_media_id, deactivated_at, deletion_scheduled_at
+`
+
+type ScheduleUserDeletionParams struct {
+	ID                  uuid.UUID
+	DeletionScheduledAt sql.NullTime
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, scheduleUserDeletion, arg.ID, arg.DeletionScheduledAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsAdmin,
+		&i.RedStartedAt,
+		&i.RedEndsAt,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeactivatedAt,
+		&i.DeletionScheduledAt,
 	)
 	return i, err
 }
 
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
-SET hashed_password = $2, email = $3, updated_at = NOW()
+SET hashed_password = $2, email = $3, username = COALESCE($4, username), updated_at = NOW()
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, red_started_at, red_ends_at, username, display_name, bio, avatar_media_id, deactivated_at, deletion_scheduled_at
 `
 
 type UpdateUserParams struct {
 	ID             uuid.UUID
 	HashedPassword string
 	Email          string
+	Username       sql.NullString
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.ID, arg.HashedPassword, arg.Email)
+	row := q.db.QueryRowContext(ctx, updateUser,
+		arg.ID,
+		arg.HashedPassword,
+		arg.Email,
+		arg.Username,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -106,18 +384,77 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.IsAdmin,
+		&i.RedStartedAt,
+		&i.RedEndsAt,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeactivatedAt,
+		&i.DeletionScheduledAt,
+	)
+	return i, err
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users
+SET display_name = $2, bio = $3, avatar_media_id = $4, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, red_started_at, red_ends_at, username, display_name, bio, avatar_media_id, deactivated_at, deletion_scheduled_at
+`
+
+type UpdateUserProfileParams struct {
+	ID            uuid.UUID
+	DisplayName   string
+	Bio           string
+	AvatarMediaID uuid.NullUUID
+}
+
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile,
+		arg.ID,
+		arg.DisplayName,
+		arg.Bio,
+		arg.AvatarMediaID,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsAdmin,
+		&i.RedStartedAt,
+		&i.RedEndsAt,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeactivatedAt,
+		&i.DeletionScheduledAt,
 	)
 	return i, err
 }
 
 const upgradeUserRedChirp = `-- name: UpgradeUserRedChirp :one
 UPDATE users
-SET is_chirpy_red = true WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SET is_chirpy_red = true,
+  red_started_at = CASE WHEN is_chirpy_red THEN COALESCE(red_started_at, NOW()) ELSE NOW() END,
+  red_ends_at = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, red_started_at, red_ends_at, username, display_name, bio, avatar_media_id, deactivated_at, deletion_scheduled_at
 `
 
-func (q *Queries) UpgradeUserRedChirp(ctx context.Context, id uuid.UUID) (User, error) {
-	row := q.db.QueryRowContext(ctx, upgradeUserRedChirp, id)
+type UpgradeUserRedChirpParams struct {
+	ID        uuid.UUID
+	RedEndsAt sql.NullTime
+}
+
+func (q *Queries) UpgradeUserRedChirp(ctx context.Context, arg UpgradeUserRedChirpParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, upgradeUserRedChirp, arg.ID, arg.RedEndsAt)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -126,6 +463,15 @@ func (q *Queries) UpgradeUserRedChirp(ctx context.Context, id uuid.UUID) (User,
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.IsAdmin,
+		&i.RedStartedAt,
+		&i.RedEndsAt,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeactivatedAt,
+		&i.DeletionScheduledAt,
 	)
 	return i, err
 }
@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+)
+
+// loggedDB logs failed queries with the context of the request that made them.
+type loggedDB struct {
+	db database.DBTX
+}
+
+func LogDB(db database.DBTX) database.DBTX {
+	return &loggedDB{db: db}
+}
+
+func (l *loggedDB) log(ctx context.Context, query string, err error) {
+	if err == nil || errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+
+	slog.ErrorContext(ctx, "database query failed", "query", database.QueryName(query), "error", err.Error())
+}
+
+func (l *loggedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	res, err := l.db.ExecContext(ctx, query, args...)
+	l.log(ctx, query, err)
+
+	return res, err
+}
+
+func (l *loggedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	stmt, err := l.db.PrepareContext(ctx, query)
+	l.log(ctx, query, err)
+
+	return stmt, err
+}
+
+func (l *loggedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := l.db.QueryContext(ctx, query, args...)
+	l.log(ctx, query, err)
+
+	return rows, err
+}
+
+func (l *loggedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	row := l.db.QueryRowContext(ctx, query, args...)
+	l.log(ctx, query, row.Err())
+
+	return row
+}
@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type ctxKey struct{}
+
+// requestInfo is shared between the logging middleware and the handlers: the
+// middleware creates it, handlers fill in the user once they authenticated
+// the request, and every log record made with the context picks it up.
+type requestInfo struct {
+	mu        sync.Mutex
+	requestID string
+	userID    uuid.UUID
+}
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, &requestInfo{requestID: requestID})
+}
+
+func RequestID(ctx context.Context) string {
+	info, ok := ctx.Value(ctxKey{}).(*requestInfo)
+	if !ok {
+		return ""
+	}
+
+	return info.requestID
+}
+
+// SetUserID attaches the authenticated user to the request the context
+// belongs to. It is a no-op outside of a logged request.
+func SetUserID(ctx context.Context, userID uuid.UUID) {
+	info, ok := ctx.Value(ctxKey{}).(*requestInfo)
+	if !ok {
+		return
+	}
+
+	info.mu.Lock()
+	info.userID = userID
+	info.mu.Unlock()
+}
+
+func UserID(ctx context.Context) uuid.UUID {
+	info, ok := ctx.Value(ctxKey{}).(*requestInfo)
+	if !ok {
+		return uuid.Nil
+	}
+
+	info.mu.Lock()
+	defer info.mu.Unlock()
+
+	return info.userID
+}
+
+// New returns a JSON logger that adds request_id, user_id and trace_id to
+// records logged with a request context.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(&contextHandler{
+		Handler: slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}),
+	})
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := RequestID(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+
+	if userID := UserID(ctx); userID != uuid.Nil {
+		record.AddAttrs(slog.String("user_id", userID.String()))
+	}
+
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		record.AddAttrs(slog.String("trace_id", spanContext.TraceID().String()))
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
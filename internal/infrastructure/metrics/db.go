@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+)
+
+// instrumentedDB measures every query that goes through database.Queries.
+type instrumentedDB struct {
+	db      database.DBTX
+	metrics *Metrics
+}
+
+// InstrumentDB wraps db so that the duration of each query is recorded
+// under the name sqlc put into the query comment.
+func (m *Metrics) InstrumentDB(db database.DBTX) database.DBTX {
+	return &instrumentedDB{db: db, metrics: m}
+}
+
+func (i *instrumentedDB) observe(query string, start time.Time, err error) {
+	i.metrics.QueryDuration.WithLabelValues(
+		database.QueryName(query),
+		strconv.FormatBool(err != nil && !errors.Is(err, sql.ErrNoRows)),
+	).Observe(time.Since(start).Seconds())
+}
+
+func (i *instrumentedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	res, err := i.db.ExecContext(ctx, query, args...)
+	i.observe(query, start, err)
+
+	return res, err
+}
+
+func (i *instrumentedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return i.db.PrepareContext(ctx, query)
+}
+
+func (i *instrumentedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := i.db.QueryContext(ctx, query, args...)
+	i.observe(query, start, err)
+
+	return rows, err
+}
+
+func (i *instrumentedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := i.db.QueryRowContext(ctx, query, args...)
+	i.observe(query, start, row.Err())
+
+	return row
+}
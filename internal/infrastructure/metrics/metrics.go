@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/mashfeii/chirpy/internal/infrastructure/api"
+)
+
+const namespace = "chirpy"
+
+// Metrics holds every collector exposed on /metrics.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	RequestsTotal   *prometheus.CounterVec
+	RequestDuration *prometheus.HistogramVec
+	QueryDuration   *prometheus.HistogramVec
+	LoginFailures   prometheus.Counter
+	ChirpsCreated   prometheus.Counter
+	FileserverHits  prometheus.Counter
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		RequestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of handled HTTP requests by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		RequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		QueryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Latency of database queries by sqlc query name.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"query", "error"}),
+		LoginFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "login_failures_total",
+			Help:      "Number of rejected login attempts.",
+		}),
+		ChirpsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "chirps_created_total",
+			Help:      "Number of created chirps.",
+		}),
+		FileserverHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "fileserver_hits_total",
+			Help:      "Number of requests served by the /app/ file server.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.RequestsTotal,
+		m.RequestDuration,
+		m.QueryDuration,
+		m.LoginFailures,
+		m.ChirpsCreated,
+		m.FileserverHits,
+	)
+
+	return m
+}
+
+// RegisterActiveSessions exposes a gauge that asks count for the number of
+// active sessions every time /metrics is scraped.
+func (m *Metrics) RegisterActiveSessions(count func(ctx context.Context) (int64, error)) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_sessions",
+		Help:      "Number of refresh tokens that are neither expired nor revoked.",
+	}, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		n, err := count(ctx)
+		if err != nil {
+			return -1
+		}
+
+		return float64(n)
+	}))
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records count and latency of every request. The route label is
+// the ServeMux pattern, which is only known after the mux has handled the
+// request, so next is expected to be the mux itself.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := api.NewStatusWriter(w)
+
+		next.ServeHTTP(sw, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+
+		labels := prometheus.Labels{
+			"route":  route,
+			"method": r.Method,
+			"status": strconv.Itoa(sw.Status),
+		}
+
+		m.RequestsTotal.With(labels).Inc()
+		m.RequestDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mashfeii/chirpy/internal/infrastructure/database"
+)
+
+// tracedDB starts a client span for every query made through database.Queries.
+type tracedDB struct {
+	db database.DBTX
+}
+
+func TraceDB(db database.DBTX) database.DBTX {
+	return &tracedDB{db: db}
+}
+
+func (t *tracedDB) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := database.QueryName(query)
+
+	return Tracer().Start(ctx, "db "+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(name),
+			semconv.DBQueryText(query),
+		),
+	)
+}
+
+func finish(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+func (t *tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := t.start(ctx, query)
+	res, err := t.db.ExecContext(ctx, query, args...)
+	finish(span, err)
+
+	return res, err
+}
+
+func (t *tracedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := t.start(ctx, query)
+	stmt, err := t.db.PrepareContext(ctx, query)
+	finish(span, err)
+
+	return stmt, err
+}
+
+func (t *tracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := t.start(ctx, query)
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	finish(span, err)
+
+	return rows, err
+}
+
+func (t *tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := t.start(ctx, query)
+	row := t.db.QueryRowContext(ctx, query, args...)
+	finish(span, row.Err())
+
+	return row
+}
@@ -0,0 +1,20 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// BlobStore stores opaque blobs under slash-separated keys and knows the
+// public URL each of them is served from.
+type BlobStore interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
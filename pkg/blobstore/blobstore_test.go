@@ -0,0 +1,181 @@
+package blobstore_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mashfeii/chirpy/pkg/blobstore"
+)
+
+// fakeS3 is a stand-in for an S3-compatible service that keeps objects in
+// memory and checks that requests are signed.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(body)
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") ||
+		r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[r.URL.Path] = body
+	case http.MethodGet:
+		object, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write(object)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestBlobStores(t *testing.T) {
+	t.Parallel()
+
+	local, err := blobstore.NewLocalStore(t.TempDir(), "/media/")
+	if err != nil {
+		t.Fatalf("NewLocalStore() error = %v", err)
+	}
+
+	server := httptest.NewServer(&fakeS3{objects: map[string][]byte{}})
+	t.Cleanup(server.Close)
+
+	s3 := blobstore.NewS3Store(server.Client(), blobstore.S3Config{
+		Endpoint:  server.URL,
+		Bucket:    "chirpy",
+		AccessKey: "access",
+		SecretKey: "secret",
+	})
+
+	tests := []struct {
+		name    string
+		store   blobstore.BlobStore
+		wantURL string
+	}{
+		{
+			name:    "Local",
+			store:   local,
+			wantURL: "/media/a1/original.png",
+		},
+		{
+			name:    "S3",
+			store:   s3,
+			wantURL: server.URL + "/chirpy/a1/original.png",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			key := "a1/original.png"
+			data := []byte("not really a png")
+
+			if err := tt.store.Put(ctx, key, "image/png", data); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+
+			got, err := tt.store.Get(ctx, key)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("Get() = %q, %v, want %q", got, err, data)
+			}
+
+			if url := tt.store.URL(key); url != tt.wantURL {
+				t.Errorf("URL() = %q, want %q", url, tt.wantURL)
+			}
+
+			if err := tt.store.Delete(ctx, key); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+
+			if _, err := tt.store.Get(ctx, key); !errors.Is(err, blobstore.ErrNotFound) {
+				t.Errorf("Get() after Delete() error = %v, want %v", err, blobstore.ErrNotFound)
+			}
+
+			if err := tt.store.Delete(ctx, key); err != nil {
+				t.Errorf("Delete() of a missing blob error = %v", err)
+			}
+		})
+	}
+}
+
+func TestLocalStoreRejectsEscapingKeys(t *testing.T) {
+	t.Parallel()
+
+	store, err := blobstore.NewLocalStore(t.TempDir(), "/media")
+	if err != nil {
+		t.Fatalf("NewLocalStore() error = %v", err)
+	}
+
+	for _, key := range []string{"", "../outside", "/etc/passwd", "a/../../outside"} {
+		if err := store.Put(context.Background(), key, "text/plain", nil); !errors.Is(err, blobstore.ErrInvalidKey) {
+			t.Errorf("Put(%q) error = %v, want %v", key, err, blobstore.ErrInvalidKey)
+		}
+	}
+}
+
+func TestLocalStoreHandler(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	store, err := blobstore.NewLocalStore(t.TempDir(), "/media")
+	if err != nil {
+		t.Fatalf("NewLocalStore() error = %v", err)
+	}
+
+	for _, key := range []string{"public/a.png", "private/b.png"} {
+		if err = store.Put(ctx, key, "image/png", []byte(key)); err != nil {
+			t.Fatalf("Put(%q) error = %v", key, err)
+		}
+	}
+
+	handler := http.StripPrefix("/media/", store.Handler(func(key string) bool {
+		return strings.HasPrefix(key, "public/")
+	}))
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/media/public/a.png", http.StatusOK},
+		{"/media/private/b.png", http.StatusNotFound},
+		{"/media/public/../private/b.png", http.StatusNotFound},
+		{"/media/public/", http.StatusNotFound},
+		{"/media/", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if rec.Code != tt.want {
+			t.Errorf("GET %s status = %d, want %d", tt.path, rec.Code, tt.want)
+		}
+	}
+}
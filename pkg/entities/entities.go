@@ -0,0 +1,123 @@
+package entities
+
+import (
+	"strings"
+	"unicode"
+)
+
+type Type string
+
+const (
+	Mention Type = "mention"
+	Hashtag Type = "hashtag"
+)
+
+const (
+	MaxHandleLength = 30
+	MaxTagLength    = 100
+)
+
+// Entity is a mention or a hashtag found in a text. Start and End are
+// offsets in Unicode code points covering the @ or # prefix, End being
+// exclusive. Value is the handle or tag, lowercased and without its prefix.
+type Entity struct {
+	Type  Type
+	Value string
+	Start int
+	End   int
+}
+
+// Parse finds the @handle mentions and #tag hashtags of text. An entity has
+// to start the text or follow a character that is not part of a word, so
+// emails and anchors like a#b are not matched. Handles are made of ASCII
+// letters, digits and underscores, tags of any letters, digits and
+// underscores with at least one letter.
+func Parse(text string) []Entity {
+	var found []Entity
+
+	runes := []rune(text)
+
+	for i := 0; i < len(runes); i++ {
+		prefix := runes[i]
+		if prefix != '@' && prefix != '#' {
+			continue
+		}
+
+		if i > 0 && (isWordRune(runes[i-1]) || runes[i-1] == '@' || runes[i-1] == '#') {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+
+		value := string(runes[i+1 : end])
+
+		var valid bool
+
+		switch {
+		// A trailing @ or # means something else, like an email.
+		case end < len(runes) && (runes[end] == '@' || runes[end] == '#'):
+		case prefix == '@':
+			valid = isHandle(value)
+		default:
+			valid = isTag(value)
+		}
+
+		if valid {
+			entityType := Hashtag
+			if prefix == '@' {
+				entityType = Mention
+			}
+
+			found = append(found, Entity{
+				Type:  entityType,
+				Value: strings.ToLower(value),
+				Start: i,
+				End:   end,
+			})
+		}
+
+		i = end - 1
+	}
+
+	return found
+}
+
+// Values returns the distinct values of the entities of type t.
+func Values(found []Entity, t Type) []string {
+	values := []string{}
+	seen := map[string]bool{}
+
+	for _, entity := range found {
+		if entity.Type == t && !seen[entity.Value] {
+			seen[entity.Value] = true
+			values = append(values, entity.Value)
+		}
+	}
+
+	return values
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isHandle(value string) bool {
+	if value == "" || len(value) > MaxHandleLength {
+		return false
+	}
+
+	for _, r := range value {
+		if r != '_' && (r > unicode.MaxASCII || !unicode.IsLetter(r) && !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isTag(value string) bool {
+	return len([]rune(value)) <= MaxTagLength && strings.IndexFunc(value, unicode.IsLetter) >= 0
+}
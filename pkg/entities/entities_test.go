@@ -0,0 +1,81 @@
+package entities_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mashfeii/chirpy/pkg/entities"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []entities.Entity
+	}{
+		{
+			name: "Mention and hashtag",
+			text: "hi @Alice, see #Go!",
+			want: []entities.Entity{
+				{Type: entities.Mention, Value: "alice", Start: 3, End: 9},
+				{Type: entities.Hashtag, Value: "go", Start: 15, End: 18},
+			},
+		},
+		{
+			name: "Offsets in code points",
+			text: "привет #чирп @bob",
+			want: []entities.Entity{
+				{Type: entities.Hashtag, Value: "чирп", Start: 7, End: 12},
+				{Type: entities.Mention, Value: "bob", Start: 13, End: 17},
+			},
+		},
+		{
+			name: "Inside words",
+			text: "mail me at bob@example.com or a#b",
+			want: nil,
+		},
+		{
+			name: "Numeric tag and bare prefixes",
+			text: "#1 @ # @@bob",
+			want: nil,
+		},
+		{
+			name: "Non-ASCII handle",
+			text: "@бob",
+			want: nil,
+		},
+		{
+			name: "Handle too long",
+			text: "@abcdefghijklmnopqrstuvwxyz12345",
+			want: nil,
+		},
+		{
+			name: "Trailing punctuation",
+			text: "(@carol) #fun_times.",
+			want: []entities.Entity{
+				{Type: entities.Mention, Value: "carol", Start: 1, End: 7},
+				{Type: entities.Hashtag, Value: "fun_times", Start: 9, End: 19},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := entities.Parse(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValues(t *testing.T) {
+	found := entities.Parse("#go @bob #Go #rust @Bob")
+
+	if got := entities.Values(found, entities.Hashtag); !reflect.DeepEqual(got, []string{"go", "rust"}) {
+		t.Errorf("Values(Hashtag) = %v", got)
+	}
+
+	if got := entities.Values(found, entities.Mention); !reflect.DeepEqual(got, []string{"bob"}) {
+		t.Errorf("Values(Mention) = %v", got)
+	}
+}
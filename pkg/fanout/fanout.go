@@ -0,0 +1,113 @@
+package fanout
+
+import (
+	"sync"
+)
+
+// Hub broadcasts messages to subscribers without ever blocking the
+// publisher. Each subscriber has a bounded buffer; a subscriber that lets it
+// fill up is considered too slow and is disconnected by closing its channel.
+type Hub[T any] struct {
+	mu     sync.Mutex
+	subs   map[*Subscription[T]]struct{}
+	buffer int
+	done   chan struct{}
+}
+
+type Subscription[T any] struct {
+	hub    *Hub[T]
+	match  func(T) bool
+	ch     chan T
+	closed bool
+}
+
+func New[T any](buffer int) *Hub[T] {
+	return &Hub[T]{
+		subs:   map[*Subscription[T]]struct{}{},
+		buffer: buffer,
+		done:   make(chan struct{}),
+	}
+}
+
+// Subscribe registers a subscriber that receives every published message
+// match accepts. A nil match accepts everything.
+func (h *Hub[T]) Subscribe(match func(T) bool) *Subscription[T] {
+	sub := &Subscription[T]{
+		hub:   h,
+		match: match,
+		ch:    make(chan T, h.buffer),
+	}
+
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+
+	return sub
+}
+
+func (h *Hub[T]) Publish(msg T) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs {
+		if sub.match != nil && !sub.match(msg) {
+			continue
+		}
+
+		select {
+		case sub.ch <- msg:
+		default:
+			h.remove(sub)
+		}
+	}
+}
+
+// Len returns the number of connected subscribers.
+func (h *Hub[T]) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subs)
+}
+
+// Close signals subscribers through Done that the hub is going away, for
+// instance because the server is shutting down. It can be called more than
+// once.
+func (h *Hub[T]) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	select {
+	case <-h.done:
+	default:
+		close(h.done)
+	}
+}
+
+// Done is closed once Close has been called.
+func (h *Hub[T]) Done() <-chan struct{} {
+	return h.done
+}
+
+func (h *Hub[T]) remove(sub *Subscription[T]) {
+	if sub.closed {
+		return
+	}
+
+	sub.closed = true
+	delete(h.subs, sub)
+	close(sub.ch)
+}
+
+// C delivers the messages. It is closed when the subscription is closed or
+// the subscriber has been disconnected for being too slow.
+func (s *Subscription[T]) C() <-chan T {
+	return s.ch
+}
+
+func (s *Subscription[T]) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.hub.remove(s)
+}
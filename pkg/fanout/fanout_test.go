@@ -0,0 +1,106 @@
+package fanout_test
+
+import (
+	"testing"
+
+	"github.com/mashfeii/chirpy/pkg/fanout"
+)
+
+func TestHubPublish(t *testing.T) {
+	t.Parallel()
+
+	hub := fanout.New[int](2)
+
+	all := hub.Subscribe(nil)
+	even := hub.Subscribe(func(n int) bool { return n%2 == 0 })
+
+	hub.Publish(1)
+	hub.Publish(2)
+
+	if got := <-all.C(); got != 1 {
+		t.Errorf("first message = %d, want 1", got)
+	}
+
+	if got := <-all.C(); got != 2 {
+		t.Errorf("second message = %d, want 2", got)
+	}
+
+	if got := <-even.C(); got != 2 {
+		t.Errorf("filtered message = %d, want 2", got)
+	}
+
+	if hub.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", hub.Len())
+	}
+}
+
+func TestHubDisconnectsSlowSubscriber(t *testing.T) {
+	t.Parallel()
+
+	hub := fanout.New[int](1)
+
+	slow := hub.Subscribe(nil)
+	fast := hub.Subscribe(nil)
+
+	hub.Publish(1)
+	<-fast.C()
+
+	// slow has not read its first message, the second one does not fit.
+	hub.Publish(2)
+
+	if got := <-fast.C(); got != 2 {
+		t.Errorf("fast subscriber got %d, want 2", got)
+	}
+
+	if got, ok := <-slow.C(); !ok || got != 1 {
+		t.Errorf("slow subscriber got %d, %v, want buffered 1", got, ok)
+	}
+
+	if _, ok := <-slow.C(); ok {
+		t.Error("slow subscriber was not disconnected")
+	}
+
+	if hub.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", hub.Len())
+	}
+}
+
+func TestSubscriptionClose(t *testing.T) {
+	t.Parallel()
+
+	hub := fanout.New[int](1)
+	sub := hub.Subscribe(nil)
+
+	sub.Close()
+	sub.Close()
+	hub.Publish(1)
+
+	if _, ok := <-sub.C(); ok {
+		t.Error("closed subscription received a message")
+	}
+
+	if hub.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", hub.Len())
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	t.Parallel()
+
+	hub := fanout.New[int](1)
+
+	select {
+	case <-hub.Done():
+		t.Fatal("Done is closed before Close")
+	default:
+	}
+
+	hub.Close()
+	hub.Close()
+
+	select {
+	case <-hub.Done():
+	default:
+		t.Error("Done is not closed after Close")
+	}
+}
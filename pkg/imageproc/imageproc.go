@@ -0,0 +1,156 @@
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // register GIF for image.Decode
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register WebP for image.Decode
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported image format")
+	ErrTooLarge    = errors.New("image dimensions exceed the limit")
+)
+
+// inputTypes are the accepted content types, as sniffed from the data.
+var inputTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Size is a thumbnail that fits in a MaxEdge x MaxEdge box.
+type Size struct {
+	Name    string
+	MaxEdge int
+}
+
+// Image is an encoded image produced by Process.
+type Image struct {
+	Data        []byte
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+}
+
+type Result struct {
+	Original   Image
+	Thumbnails map[string]Image
+}
+
+// Processor sanitizes uploaded images. Every output is re-encoded from the
+// decoded pixels, so no metadata of the upload survives: JPEGs stay JPEGs,
+// everything else becomes a PNG. Animated GIFs keep their first frame.
+type Processor struct {
+	// MaxPixels guards against decompression bombs: small files that
+	// declare huge dimensions. They are rejected before being decoded.
+	MaxPixels   int
+	JPEGQuality int
+	Sizes       []Size
+}
+
+// Check validates data from its header only and returns its content type
+// and dimensions.
+func (p Processor) Check(data []byte) (string, image.Config, error) {
+	contentType := http.DetectContentType(data)
+	if !inputTypes[contentType] {
+		return contentType, image.Config{}, fmt.Errorf("%w: %s", ErrUnsupported, contentType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return contentType, config, fmt.Errorf("%w: %s", ErrUnsupported, err.Error())
+	}
+
+	if config.Width <= 0 || config.Height <= 0 || config.Width > p.MaxPixels/config.Height {
+		return contentType, config, fmt.Errorf("%w: %dx%d", ErrTooLarge, config.Width, config.Height)
+	}
+
+	return contentType, config, nil
+}
+
+func (p Processor) Process(data []byte) (Result, error) {
+	contentType, _, err := p.Check(data)
+	if err != nil {
+		return Result{}, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %s", ErrUnsupported, err.Error())
+	}
+
+	if contentType == "image/jpeg" {
+		img = orient(img, exifOrientation(data))
+	}
+
+	original, err := p.encode(img, contentType)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{Original: original, Thumbnails: make(map[string]Image, len(p.Sizes))}
+
+	for _, size := range p.Sizes {
+		thumbnail, err := p.encode(fit(img, size.MaxEdge), contentType)
+		if err != nil {
+			return Result{}, err
+		}
+
+		result.Thumbnails[size.Name] = thumbnail
+	}
+
+	return result, nil
+}
+
+func (p Processor) encode(img image.Image, inputType string) (Image, error) {
+	var (
+		buffer bytes.Buffer
+		err    error
+	)
+
+	encoded := Image{Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+
+	if inputType == "image/jpeg" {
+		encoded.ContentType, encoded.Extension = "image/jpeg", ".jpg"
+		err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: p.JPEGQuality})
+	} else {
+		encoded.ContentType, encoded.Extension = "image/png", ".png"
+		err = png.Encode(&buffer, img)
+	}
+
+	encoded.Data = buffer.Bytes()
+
+	return encoded, err
+}
+
+// fit scales img down to fit in a maxEdge x maxEdge box. Smaller images are
+// kept as they are.
+func fit(img image.Image, maxEdge int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width <= maxEdge && height <= maxEdge {
+		return img
+	}
+
+	if width >= height {
+		width, height = maxEdge, max(1, height*maxEdge/width)
+	} else {
+		width, height = max(1, width*maxEdge/height), maxEdge
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+
+	return dst
+}
@@ -0,0 +1,201 @@
+package imageproc_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/mashfeii/chirpy/pkg/imageproc"
+)
+
+var processor = imageproc.Processor{
+	MaxPixels:   1 << 20,
+	JPEGQuality: 85,
+	Sizes: []imageproc.Size{
+		{Name: "small", MaxEdge: 16},
+		{Name: "large", MaxEdge: 1024},
+	},
+}
+
+func testImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+func encodeGIF(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	if err := gif.Encode(&buffer, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+// encodeJPEG encodes img with an EXIF segment holding orientation.
+func encodeJPEG(t *testing.T, img image.Image, orientation byte) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	exif := []byte("Exif\x00\x00MM\x00*\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00")
+	exif = append(exif, orientation, 0, 0, 0, 0, 0, 0)
+	segment := append([]byte{0xFF, 0xE1, 0, byte(len(exif) + 2)}, exif...)
+
+	data := buffer.Bytes()
+
+	return append(append([]byte{0xFF, 0xD8}, segment...), data[2:]...)
+}
+
+func TestProcess(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		data            func(t *testing.T) []byte
+		wantType        string
+		wantWidth       int
+		wantHeight      int
+		wantSmallWidth  int
+		wantSmallHeight int
+	}{
+		{
+			name:            "PNG",
+			data:            func(t *testing.T) []byte { return encodePNG(t, testImage(64, 32)) },
+			wantType:        "image/png",
+			wantWidth:       64,
+			wantHeight:      32,
+			wantSmallWidth:  16,
+			wantSmallHeight: 8,
+		},
+		{
+			name:            "GIF becomes PNG",
+			data:            func(t *testing.T) []byte { return encodeGIF(t, testImage(32, 64)) },
+			wantType:        "image/png",
+			wantWidth:       32,
+			wantHeight:      64,
+			wantSmallWidth:  8,
+			wantSmallHeight: 16,
+		},
+		{
+			name:            "Upright JPEG",
+			data:            func(t *testing.T) []byte { return encodeJPEG(t, testImage(64, 32), 1) },
+			wantType:        "image/jpeg",
+			wantWidth:       64,
+			wantHeight:      32,
+			wantSmallWidth:  16,
+			wantSmallHeight: 8,
+		},
+		{
+			name:            "Rotated JPEG",
+			data:            func(t *testing.T) []byte { return encodeJPEG(t, testImage(64, 32), 6) },
+			wantType:        "image/jpeg",
+			wantWidth:       32,
+			wantHeight:      64,
+			wantSmallWidth:  8,
+			wantSmallHeight: 16,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			result, err := processor.Process(tt.data(t))
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+
+			original := result.Original
+			if original.ContentType != tt.wantType || original.Width != tt.wantWidth || original.Height != tt.wantHeight {
+				t.Errorf("Process() original = %s %dx%d, want %s %dx%d",
+					original.ContentType, original.Width, original.Height, tt.wantType, tt.wantWidth, tt.wantHeight)
+			}
+
+			if bytes.Contains(original.Data, []byte("Exif")) {
+				t.Error("Process() kept EXIF metadata")
+			}
+
+			config, _, err := image.DecodeConfig(bytes.NewReader(original.Data))
+			if err != nil || config.Width != tt.wantWidth || config.Height != tt.wantHeight {
+				t.Errorf("original decodes as %dx%d, %v", config.Width, config.Height, err)
+			}
+
+			small := result.Thumbnails["small"]
+			if small.Width != tt.wantSmallWidth || small.Height != tt.wantSmallHeight {
+				t.Errorf("small thumbnail = %dx%d, want %dx%d", small.Width, small.Height, tt.wantSmallWidth, tt.wantSmallHeight)
+			}
+
+			// Images are never scaled up.
+			if large := result.Thumbnails["large"]; large.Width != tt.wantWidth || large.Height != tt.wantHeight {
+				t.Errorf("large thumbnail = %dx%d, want %dx%d", large.Width, large.Height, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	t.Parallel()
+
+	// A GIF header declaring 60000x60000 pixels.
+	bomb := []byte("GIF89a\x60\xea\x60\xea\x00\x00\x00;")
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{
+			name:    "Not an image",
+			data:    []byte("hello, world"),
+			wantErr: imageproc.ErrUnsupported,
+		},
+		{
+			name:    "Truncated PNG",
+			data:    []byte("\x89PNG\r\n\x1a\n"),
+			wantErr: imageproc.ErrUnsupported,
+		},
+		{
+			name:    "Decompression bomb",
+			data:    bomb,
+			wantErr: imageproc.ErrTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := processor.Process(tt.data); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Process() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
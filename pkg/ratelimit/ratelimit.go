@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests requests per Per, refilled continuously, with bursts
+// of up to Requests.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// ParseLimit parses limits written as "requests/period", e.g. "30/1m".
+func ParseLimit(s string) (Limit, error) {
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("limit %q is not in requests/period form", s)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(requests))
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid amount of requests in limit %q", s)
+	}
+
+	per, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil || per <= 0 {
+		return Limit{}, fmt.Errorf("invalid period in limit %q", s)
+	}
+
+	return Limit{Requests: n, Per: per}, nil
+}
+
+// Result describes the state of a bucket after a request has been counted.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets. Implementations backed by a shared store let
+// several replicas enforce a single quota.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	per     time.Duration
+}
+
+// MemoryStore keeps buckets in process memory.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+	takes   int
+}
+
+const sweepEvery = 1024
+
+type Option func(*MemoryStore)
+
+// WithClock replaces time.Now, which is mostly useful in tests.
+func WithClock(now func() time.Time) Option {
+	return func(s *MemoryStore) {
+		s.now = now
+	}
+}
+
+func NewMemoryStore(opts ...Option) *MemoryStore {
+	s := &MemoryStore{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	capacity := float64(limit.Requests)
+	rate := limit.rate()
+
+	s.takes++
+	if s.takes%sweepEvery == 0 {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now, per: limit.Per}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+
+	result := Result{Limit: limit.Requests}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - b.tokens) / rate)
+	}
+
+	result.Remaining = int(b.tokens)
+	result.ResetAfter = secondsToDuration((capacity - b.tokens) / rate)
+
+	return result, nil
+}
+
+// sweep forgets buckets that have been idle long enough to be full again.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) > b.per {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
@@ -0,0 +1,101 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mashfeii/chirpy/pkg/ratelimit"
+)
+
+func TestParseLimit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		input   string
+		want    ratelimit.Limit
+		wantErr bool
+	}{
+		{
+			name:  "Per minute",
+			input: "30/1m",
+			want:  ratelimit.Limit{Requests: 30, Per: time.Minute},
+		},
+		{
+			name:  "With spaces",
+			input: " 5 / 10s ",
+			want:  ratelimit.Limit{Requests: 5, Per: 10 * time.Second},
+		},
+		{
+			name:    "Error: missing period",
+			input:   "30",
+			wantErr: true,
+		},
+		{
+			name:    "Error: zero requests",
+			input:   "0/1m",
+			wantErr: true,
+		},
+		{
+			name:    "Error: invalid period",
+			input:   "10/minute",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ratelimit.ParseLimit(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseLimit() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("ParseLimit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	now := time.Now()
+	store := ratelimit.NewMemoryStore(ratelimit.WithClock(func() time.Time { return now }))
+	limit := ratelimit.Limit{Requests: 2, Per: 2 * time.Second}
+
+	steps := []struct {
+		name          string
+		key           string
+		advance       time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+	}{
+		{name: "First request", key: "a", wantAllowed: true, wantRemaining: 1},
+		{name: "Burst", key: "a", wantAllowed: true, wantRemaining: 0},
+		{name: "Exhausted", key: "a", wantAllowed: false, wantRemaining: 0, wantRetry: time.Second},
+		{name: "Other key", key: "b", wantAllowed: true, wantRemaining: 1},
+		{name: "Refilled", key: "a", advance: time.Second, wantAllowed: true, wantRemaining: 0},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+
+		got, err := store.Take(context.Background(), step.key, limit)
+		if err != nil {
+			t.Fatalf("%s: Take() error = %v", step.name, err)
+		}
+
+		if got.Allowed != step.wantAllowed || got.Remaining != step.wantRemaining || got.RetryAfter != step.wantRetry {
+			t.Errorf("%s: Take() = %+v, want allowed %v, remaining %d, retry after %v",
+				step.name, got, step.wantAllowed, step.wantRemaining, step.wantRetry)
+		}
+
+		if got.Limit != limit.Requests {
+			t.Errorf("%s: Take() limit = %d, want %d", step.name, got.Limit, limit.Requests)
+		}
+	}
+}
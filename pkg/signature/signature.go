@@ -0,0 +1,75 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed = errors.New("malformed signature header")
+	ErrExpired   = errors.New("signature timestamp is outside of the tolerance")
+	ErrMismatch  = errors.New("signature does not match")
+)
+
+// Sign returns a header value in "t=<unix>,v1=<hex>" form, where v1 is the
+// HMAC-SHA256 of "<unix>.<body>" keyed with secret.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+
+	return fmt.Sprintf("t=%s,v1=%s", unix, hex.EncodeToString(mac(secret, unix, body)))
+}
+
+// Verify checks a header produced by Sign. Timestamps further than tolerance
+// from now are rejected to prevent replays of captured requests.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var (
+		unix      string
+		signature []byte
+	)
+
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+
+		switch key {
+		case "t":
+			unix = value
+		case "v1":
+			decoded, err := hex.DecodeString(value)
+			if err != nil {
+				return ErrMalformed
+			}
+
+			signature = decoded
+		}
+	}
+
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil || signature == nil {
+		return ErrMalformed
+	}
+
+	if diff := now.Sub(time.Unix(seconds, 0)); diff > tolerance || diff < -tolerance {
+		return ErrExpired
+	}
+
+	if !hmac.Equal(signature, mac(secret, unix, body)) {
+		return ErrMismatch
+	}
+
+	return nil
+}
+
+func mac(secret, unix string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(unix))
+	h.Write([]byte("."))
+	h.Write(body)
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,92 @@
+package signature_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mashfeii/chirpy/pkg/signature"
+)
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	body := []byte(`{"event":"user.upgraded"}`)
+
+	type args struct {
+		secret string
+		header string
+		body   []byte
+	}
+
+	tests := []struct {
+		name    string
+		args    args
+		wantErr error
+	}{
+		{
+			name: "Valid signature",
+			args: args{
+				secret: "secret",
+				header: signature.Sign("secret", now, body),
+				body:   body,
+			},
+		},
+		{
+			name: "Error: wrong secret",
+			args: args{
+				secret: "other",
+				header: signature.Sign("secret", now, body),
+				body:   body,
+			},
+			wantErr: signature.ErrMismatch,
+		},
+		{
+			name: "Error: tampered body",
+			args: args{
+				secret: "secret",
+				header: signature.Sign("secret", now, body),
+				body:   []byte(`{"event":"user.downgraded"}`),
+			},
+			wantErr: signature.ErrMismatch,
+		},
+		{
+			name: "Error: replayed request",
+			args: args{
+				secret: "secret",
+				header: signature.Sign("secret", now.Add(-time.Hour), body),
+				body:   body,
+			},
+			wantErr: signature.ErrExpired,
+		},
+		{
+			name: "Error: missing signature",
+			args: args{
+				secret: "secret",
+				header: "t=123",
+				body:   body,
+			},
+			wantErr: signature.ErrMalformed,
+		},
+		{
+			name: "Error: empty header",
+			args: args{
+				secret: "secret",
+				body:   body,
+			},
+			wantErr: signature.ErrMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := signature.Verify(tt.args.secret, tt.args.header, tt.args.body, 5*time.Minute, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
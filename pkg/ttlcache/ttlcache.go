@@ -0,0 +1,90 @@
+// Package ttlcache keeps values in process memory for a fixed time.
+package ttlcache
+
+import (
+	"sync"
+	"time"
+)
+
+const sweepEvery = 1024
+
+type entry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// Cache maps keys to values that are forgotten ttl after they were set.
+type Cache[K comparable, V any] struct {
+	mu      sync.Mutex
+	entries map[K]entry[V]
+	ttl     time.Duration
+	now     func() time.Time
+	sets    int
+}
+
+type Option func(*options)
+
+type options struct {
+	now func() time.Time
+}
+
+// WithClock replaces time.Now, which is mostly useful in tests.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+func New[K comparable, V any](ttl time.Duration, opts ...Option) *Cache[K, V] {
+	o := options{now: time.Now}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Cache[K, V]{entries: map[K]entry[V]{}, ttl: ttl, now: o.now}
+}
+
+// Get returns the value of key unless it is missing or has expired.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || !c.now().Before(e.expires) {
+		var zero V
+		return zero, false
+	}
+
+	return e.value, true
+}
+
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	c.sets++
+	if c.sets%sweepEvery == 0 {
+		c.sweep(now)
+	}
+
+	c.entries[key] = entry[V]{value: value, expires: now.Add(c.ttl)}
+}
+
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
+
+// sweep forgets expired entries.
+func (c *Cache[K, V]) sweep(now time.Time) {
+	for key, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
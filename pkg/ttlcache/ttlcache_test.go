@@ -0,0 +1,42 @@
+package ttlcache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mashfeii/chirpy/pkg/ttlcache"
+)
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := ttlcache.New[string, int](time.Minute, ttlcache.WithClock(func() time.Time {
+		return now
+	}))
+
+	if _, ok := cache.Get("a"); ok {
+		t.Fatal("Get() of a missing key succeeded")
+	}
+
+	cache.Set("a", 1)
+
+	now = now.Add(59 * time.Second)
+
+	if got, ok := cache.Get("a"); !ok || got != 1 {
+		t.Errorf("Get() before expiry = %d, %v, want 1, true", got, ok)
+	}
+
+	now = now.Add(time.Second)
+
+	if _, ok := cache.Get("a"); ok {
+		t.Error("Get() after expiry succeeded")
+	}
+
+	cache.Set("b", 2)
+	cache.Delete("b")
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("Get() after Delete() succeeded")
+	}
+}
@@ -0,0 +1,60 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned when a subscriber resolves to an address
+// that is not publicly routable.
+var ErrForbiddenAddress = errors.New("address is not publicly routable")
+
+// sharedAddressSpace is the carrier-grade NAT range, which IsPrivate misses.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// IsPublicAddr reports whether addr may be reached by webhooks, excluding
+// loopback, private, link-local (e.g. cloud metadata) and special ranges.
+func IsPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	return addr.IsValid() && addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// NewClient returns an http.Client that only connects to public addresses
+// and does not follow redirects. The address is checked once resolved, right
+// before connecting, so DNS cannot be used to reach internal services.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+
+			if !IsPublicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, addrPort.Addr())
+			}
+
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be dialed instead of the subscriber, bypassing the check.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mashfeii/chirpy/pkg/signature"
+)
+
+const (
+	EventHeader     = "X-Chirpy-Event"
+	DeliveryHeader  = "X-Chirpy-Delivery"
+	SignatureHeader = "X-Chirpy-Signature"
+
+	baseBackoff = 10 * time.Second
+	maxBackoff  = 6 * time.Hour
+)
+
+// Delivery is a single signed POST of an event to a subscriber.
+type Delivery struct {
+	ID      string
+	Event   string
+	URL     string
+	Secret  string
+	Payload []byte
+}
+
+type Sender struct {
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewSender(client *http.Client) *Sender {
+	return &Sender{client: client, now: time.Now}
+}
+
+// Send posts the delivery and returns the status code of the response. Any
+// status outside of 2xx is reported as an error so the delivery is retried.
+func (s *Sender) Send(ctx context.Context, d Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	req.Header.Set(EventHeader, d.Event)
+	req.Header.Set(DeliveryHeader, d.ID)
+	req.Header.Set(SignatureHeader, signature.Sign(d.Secret, s.now(), d.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("subscriber responded with %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// Backoff returns how long to wait before the next attempt after attempt
+// failed attempts: 10s, 20s, 40s and so on, up to 6 hours.
+func Backoff(attempt int) time.Duration {
+	delay := baseBackoff
+
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+
+		if delay >= maxBackoff {
+			return maxBackoff
+		}
+	}
+
+	return delay
+}
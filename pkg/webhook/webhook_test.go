@@ -0,0 +1,180 @@
+package webhook_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/mashfeii/chirpy/pkg/signature"
+	"github.com/mashfeii/chirpy/pkg/webhook"
+)
+
+func TestSenderSend(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		status     int
+		wantStatus int
+		wantErr    bool
+	}{
+		{
+			name:       "Accepted",
+			status:     http.StatusOK,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "No content",
+			status:     http.StatusNoContent,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Error: subscriber failed",
+			status:     http.StatusInternalServerError,
+			wantStatus: http.StatusInternalServerError,
+			wantErr:    true,
+		},
+		{
+			name:       "Error: not a success status",
+			status:     http.StatusNotModified,
+			wantStatus: http.StatusNotModified,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			delivery := webhook.Delivery{
+				ID:      "delivery-1",
+				Event:   "chirp.created",
+				Secret:  "secret",
+				Payload: []byte(`{"type":"chirp.created"}`),
+			}
+
+			received := make(chan error, 1)
+
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				if err == nil {
+					err = signature.Verify(delivery.Secret, r.Header.Get(webhook.SignatureHeader), body, time.Minute, time.Now())
+				}
+
+				if r.Header.Get(webhook.EventHeader) != delivery.Event || r.Header.Get(webhook.DeliveryHeader) != delivery.ID {
+					t.Errorf("unexpected headers %v", r.Header)
+				}
+
+				received <- err
+
+				w.WriteHeader(tt.status)
+			}))
+			defer receiver.Close()
+
+			delivery.URL = receiver.URL
+
+			got, err := webhook.NewSender(receiver.Client()).Send(context.Background(), delivery)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.wantStatus {
+				t.Errorf("Send() = %d, want %d", got, tt.wantStatus)
+			}
+
+			if err := <-received; err != nil {
+				t.Errorf("receiver could not verify signature: %v", err)
+			}
+		})
+	}
+}
+
+func TestSenderSendUnreachable(t *testing.T) {
+	t.Parallel()
+
+	receiver := httptest.NewServer(http.NotFoundHandler())
+	url := receiver.URL
+	receiver.Close()
+
+	_, err := webhook.NewSender(http.DefaultClient).Send(context.Background(), webhook.Delivery{
+		URL:     url,
+		Payload: []byte(`{}`),
+	})
+	if err == nil {
+		t.Error("Send() to a closed receiver succeeded")
+	}
+}
+
+func TestNewClientRefusesInternalAddresses(t *testing.T) {
+	t.Parallel()
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("receiver on loopback was reached")
+	}))
+	defer receiver.Close()
+
+	_, err := webhook.NewSender(webhook.NewClient(time.Second)).Send(context.Background(), webhook.Delivery{
+		URL:     receiver.URL,
+		Payload: []byte(`{}`),
+	})
+	if !errors.Is(err, webhook.ErrForbiddenAddress) {
+		t.Errorf("Send() to loopback error = %v, want %v", err, webhook.ErrForbiddenAddress)
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::ffff:127.0.0.1", false},
+		{"224.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		if got := webhook.IsPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("IsPublicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 10 * time.Second},
+		{attempt: 2, want: 20 * time.Second},
+		{attempt: 4, want: 80 * time.Second},
+		{attempt: 12, want: 20480 * time.Second},
+		{attempt: 13, want: 6 * time.Hour},
+		{attempt: 100, want: 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := webhook.Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+-- name: CreateBlock :exec
+INSERT INTO user_blocks(blocker_id, blocked_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteBlock :exec
+DELETE FROM user_blocks
+WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: GetBlocksByUser :many
+SELECT * FROM user_blocks
+WHERE blocker_id = $1
+ORDER BY created_at DESC;
+
+-- name: CountBlockingUsers :one
+SELECT COUNT(*) FROM user_blocks
+WHERE blocked_id = sqlc.arg('blocked_id') AND blocker_id = ANY(sqlc.arg('blocker_ids')::UUID[]);
+
+-- name: IsBlockedBetween :one
+SELECT EXISTS (
+  SELECT 1 FROM user_blocks
+  WHERE (blocker_id = sqlc.arg('user_id') AND blocked_id = sqlc.arg('other_id'))
+    OR (blocker_id = sqlc.arg('other_id') AND blocked_id = sqlc.arg('user_id'))
+);
+
+-- name: GetHiddenUsers :many
+SELECT blocked_id AS user_id FROM user_blocks
+WHERE blocker_id = $1
+UNION
+SELECT blocker_id FROM user_blocks
+WHERE blocked_id = $1
+UNION
+SELECT muted_id FROM user_mutes
+WHERE muter_id = $1;
+
+-- name: CreateMute :exec
+INSERT INTO user_mutes(muter_id, muted_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteMute :exec
+DELETE FROM user_mutes
+WHERE muter_id = $1 AND muted_id = $2;
+
+-- name: GetMutesByUser :many
+SELECT * FROM user_mutes
+WHERE muter_id = $1
+ORDER BY created_at DESC;
@@ -0,0 +1,64 @@
+-- name: CreateChirpMentions :many
+INSERT INTO chirp_mentions(chirp_id, user_id, handle)
+SELECT sqlc.arg('chirp_id')::UUID, id, username FROM users
+WHERE username = ANY(sqlc.arg('handles')::TEXT[])
+  AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = users.id AND blocked_id = sqlc.arg('author_id'))
+      OR (blocker_id = sqlc.arg('author_id') AND blocked_id = users.id)
+  )
+RETURNING *;
+
+-- name: CreateChirpHashtags :exec
+INSERT INTO chirp_hashtags(chirp_id, tag)
+SELECT sqlc.arg('chirp_id')::UUID, UNNEST(sqlc.arg('tags')::TEXT[]);
+
+-- name: DeleteChirpMentions :exec
+DELETE FROM chirp_mentions
+WHERE chirp_id = $1;
+
+-- name: DeleteChirpHashtags :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id = $1;
+
+-- name: GetChirpMentionsByChirps :many
+SELECT * FROM chirp_mentions
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::UUID[]);
+
+-- name: GetChirpsByHashtag :many
+SELECT chirps.* FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+WHERE chirp_hashtags.tag = sqlc.arg('tag') AND chirps.published AND chirps.hidden_at IS NULL
+  AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = sqlc.arg('viewer_id') AND blocked_id = chirps.user_id)
+      OR (blocker_id = chirps.user_id AND blocked_id = sqlc.arg('viewer_id'))
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE muter_id = sqlc.arg('viewer_id') AND muted_id = chirps.user_id
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM users
+    WHERE users.id = chirps.user_id AND users.deactivated_at IS NOT NULL
+  )
+ORDER BY chirps.created_at;
+
+-- name: GetChirpsMentioningUser :many
+SELECT chirps.* FROM chirps
+JOIN chirp_mentions ON chirp_mentions.chirp_id = chirps.id
+WHERE chirp_mentions.user_id = sqlc.arg('user_id') AND chirps.published AND chirps.hidden_at IS NULL
+  AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = sqlc.arg('viewer_id') AND blocked_id = chirps.user_id)
+      OR (blocker_id = chirps.user_id AND blocked_id = sqlc.arg('viewer_id'))
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE muter_id = sqlc.arg('viewer_id') AND muted_id = chirps.user_id
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM users
+    WHERE users.id = chirps.user_id AND users.deactivated_at IS NOT NULL
+  )
+ORDER BY chirps.created_at;
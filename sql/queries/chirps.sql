@@ -1,17 +1,45 @@
 -- name: CreateChirp :one
-INSERT INTO chirps(id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, publish_at, published)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4)
 RETURNING *;
 
 -- name: GetChirps :many
 SELECT * FROM chirps
+WHERE ((published AND hidden_at IS NULL) OR user_id = sqlc.arg('viewer_id'))
+  AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = sqlc.arg('viewer_id') AND blocked_id = chirps.user_id)
+      OR (blocker_id = chirps.user_id AND blocked_id = sqlc.arg('viewer_id'))
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE muter_id = sqlc.arg('viewer_id') AND muted_id = chirps.user_id
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM users
+    WHERE users.id = chirps.user_id AND users.deactivated_at IS NOT NULL
+  )
 ORDER BY created_at;
 
 -- name: GetChirpsByUser :many
 SELECT * FROM chirps
-WHERE user_id = $1
+WHERE user_id = sqlc.arg('user_id')
+  AND ((published AND hidden_at IS NULL) OR user_id = sqlc.arg('viewer_id'))
+  AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = sqlc.arg('viewer_id') AND blocked_id = chirps.user_id)
+      OR (blocker_id = chirps.user_id AND blocked_id = sqlc.arg('viewer_id'))
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM users
+    WHERE users.id = chirps.user_id AND users.deactivated_at IS NOT NULL
+  )
 ORDER BY created_at;
 
+-- name: CountChirpsByUser :one
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1 AND published AND hidden_at IS NULL;
+
 -- name: GetChirp :one
 SELECT * FROM chirps
 WHERE id = $1;
@@ -19,3 +47,55 @@ WHERE id = $1;
 -- name: DeleteChirp :exec
 DELETE FROM chirps
 WHERE id = $1;
+
+-- name: HideChirp :execrows
+UPDATE chirps
+SET hidden_at = NOW()
+WHERE id = $1 AND hidden_at IS NULL;
+
+-- name: UpdateChirp :one
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetScheduledChirpsByUser :many
+SELECT * FROM chirps
+WHERE user_id = $1 AND NOT published
+ORDER BY publish_at;
+
+-- name: UpdateScheduledChirp :one
+UPDATE chirps
+SET body = $2, publish_at = $3, updated_at = NOW()
+WHERE id = $1 AND NOT published
+RETURNING *;
+
+-- name: DeleteScheduledChirp :execrows
+DELETE FROM chirps
+WHERE id = $1 AND NOT published;
+
+-- name: PublishDueChirps :many
+UPDATE chirps
+SET published = TRUE, created_at = NOW(), updated_at = NOW()
+WHERE id IN (
+  SELECT id FROM chirps
+  WHERE NOT published AND publish_at <= NOW()
+    AND NOT EXISTS (
+      SELECT 1 FROM users
+      WHERE users.id = chirps.user_id AND users.deactivated_at IS NOT NULL
+    )
+    AND NOT EXISTS (
+      SELECT 1 FROM user_suspensions
+      WHERE user_suspensions.user_id = chirps.user_id AND lifted_at IS NULL
+        AND (expires_at IS NULL OR expires_at > NOW())
+    )
+  ORDER BY publish_at
+  LIMIT $1
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: GetAllChirpsByUser :many
+SELECT * FROM chirps
+WHERE user_id = $1
+ORDER BY created_at;
@@ -0,0 +1,58 @@
+-- name: CreateConversation :one
+INSERT INTO conversations(id, created_at, updated_at, is_group, direct_key)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
+ON CONFLICT (direct_key) DO NOTHING
+RETURNING *;
+
+-- name: GetConversationByDirectKey :one
+SELECT * FROM conversations
+WHERE direct_key = $1;
+
+-- name: GetConversation :one
+SELECT * FROM conversations
+WHERE id = $1;
+
+-- name: GetConversationsByUser :many
+SELECT conversations.* FROM conversations
+JOIN conversation_participants ON conversation_participants.conversation_id = conversations.id
+WHERE conversation_participants.user_id = $1
+ORDER BY conversations.updated_at DESC;
+
+-- name: TouchConversation :exec
+UPDATE conversations
+SET updated_at = NOW()
+WHERE id = $1;
+
+-- name: AddConversationParticipants :exec
+INSERT INTO conversation_participants(conversation_id, user_id, joined_at)
+SELECT sqlc.arg('conversation_id')::UUID, UNNEST(sqlc.arg('user_ids')::UUID[]), NOW()
+ON CONFLICT DO NOTHING;
+
+-- name: GetConversationParticipants :many
+SELECT * FROM conversation_participants
+WHERE conversation_id = ANY(sqlc.arg('conversation_ids')::UUID[])
+ORDER BY joined_at;
+
+-- name: MarkConversationRead :exec
+UPDATE conversation_participants
+SET last_read_at = NOW()
+WHERE conversation_id = $1 AND user_id = $2;
+
+-- name: CreateMessage :one
+INSERT INTO messages(id, created_at, conversation_id, sender_id, body)
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3)
+RETURNING *;
+
+-- name: GetMessages :many
+SELECT * FROM messages
+WHERE conversation_id = sqlc.arg('conversation_id')
+  AND (sqlc.narg('before')::UUID IS NULL OR (created_at, id) < (
+    SELECT created_at, id FROM messages WHERE id = sqlc.narg('before')
+  ))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetMessagesBySender :many
+SELECT * FROM messages
+WHERE sender_id = $1
+ORDER BY created_at;
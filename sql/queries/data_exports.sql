@@ -0,0 +1,46 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports(id, created_at, updated_at, user_id)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1)
+RETURNING *;
+
+-- name: GetLatestDataExport :one
+SELECT * FROM data_exports
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: GetDataExportsByUser :many
+SELECT * FROM data_exports
+WHERE user_id = $1;
+
+-- name: ClaimPendingDataExports :many
+UPDATE data_exports
+SET status = 'processing', updated_at = NOW()
+WHERE id IN (
+  SELECT id FROM data_exports
+  WHERE status = 'pending' OR (status = 'processing' AND updated_at < sqlc.arg('stale_before'))
+  ORDER BY created_at
+  LIMIT sqlc.arg('limit')
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkDataExportReady :exec
+UPDATE data_exports
+SET status = 'ready', storage_key = $2, expires_at = $3, last_error = NULL, updated_at = NOW()
+WHERE id = $1;
+
+-- name: MarkDataExportFailed :exec
+UPDATE data_exports
+SET status = 'failed', last_error = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetExpiredDataExports :many
+SELECT * FROM data_exports
+WHERE expires_at < NOW()
+ORDER BY expires_at
+LIMIT $1;
+
+-- name: DeleteDataExport :exec
+DELETE FROM data_exports
+WHERE id = $1;
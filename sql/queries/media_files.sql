@@ -0,0 +1,71 @@
+-- name: CreateMediaFile :one
+INSERT INTO media_files (id, created_at, updated_at, user_id, storage_key, content_type, size_bytes, width, height, status)
+VALUES ($1, NOW(), NOW(), $2, $3, $4, $5, $6, $7, 'pending')
+RETURNING *;
+
+-- name: GetMediaFile :one
+SELECT * FROM media_files
+WHERE id = $1;
+
+-- name: AttachMediaFiles :many
+UPDATE media_files
+SET chirp_id = sqlc.arg('chirp_id')
+WHERE id = ANY(sqlc.arg('ids')::UUID[]) AND user_id = sqlc.arg('user_id')
+  AND chirp_id IS NULL AND status = 'ready'
+RETURNING *;
+
+-- name: GetMediaFilesByChirps :many
+SELECT * FROM media_files
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::UUID[])
+ORDER BY created_at;
+
+-- name: GetUnattachedMediaFiles :many
+SELECT * FROM media_files
+WHERE chirp_id IS NULL AND created_at < $1
+  AND NOT EXISTS (SELECT 1 FROM users WHERE users.avatar_media_id = media_files.id)
+ORDER BY created_at
+LIMIT $2;
+
+-- name: DeleteMediaFile :exec
+DELETE FROM media_files
+WHERE id = $1;
+
+-- name: ClaimPendingMediaFiles :many
+UPDATE media_files
+SET status = 'processing', updated_at = NOW()
+WHERE id IN (
+  SELECT id FROM media_files
+  WHERE status = 'pending' OR (status = 'processing' AND updated_at < sqlc.arg('stale_before'))
+  ORDER BY created_at
+  LIMIT sqlc.arg('limit')
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkMediaFileReady :exec
+UPDATE media_files
+SET status = 'ready', storage_key = $2, content_type = $3, size_bytes = $4, width = $5, height = $6,
+  last_error = NULL, updated_at = NOW()
+WHERE id = $1;
+
+-- name: MarkMediaFileFailed :exec
+UPDATE media_files
+SET status = 'failed', last_error = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpsertMediaVariant :exec
+INSERT INTO media_variants (media_file_id, name, storage_key, content_type, width, height)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (media_file_id, name) DO UPDATE
+SET storage_key = EXCLUDED.storage_key, content_type = EXCLUDED.content_type,
+  width = EXCLUDED.width, height = EXCLUDED.height;
+
+-- name: GetMediaVariantsByFiles :many
+SELECT * FROM media_variants
+WHERE media_file_id = ANY(sqlc.arg('media_file_ids')::UUID[])
+ORDER BY width;
+
+-- name: GetMediaFilesByUser :many
+SELECT * FROM media_files
+WHERE user_id = $1
+ORDER BY created_at;
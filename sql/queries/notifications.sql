@@ -0,0 +1,42 @@
+-- name: UpsertNotification :exec
+INSERT INTO notifications(id, created_at, updated_at, user_id, type, chirp_id, group_key, actor_ids, actor_count)
+SELECT gen_random_uuid(), NOW(), NOW(), sqlc.arg('user_id')::UUID, sqlc.arg('type')::TEXT, sqlc.narg('chirp_id')::UUID,
+  sqlc.arg('group_key')::TEXT, ARRAY[sqlc.arg('actor_id')::UUID], 1
+WHERE NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE blocker_id = sqlc.arg('user_id') AND blocked_id = sqlc.arg('actor_id')
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE muter_id = sqlc.arg('user_id') AND muted_id = sqlc.arg('actor_id')
+  )
+ON CONFLICT (user_id, type, group_key) WHERE read_at IS NULL
+DO UPDATE SET
+  chirp_id = EXCLUDED.chirp_id,
+  actor_ids = EXCLUDED.actor_ids || notifications.actor_ids,
+  actor_count = notifications.actor_count + 1,
+  updated_at = NOW()
+WHERE NOT EXCLUDED.actor_ids[1] = ANY(notifications.actor_ids);
+
+-- name: GetNotifications :many
+SELECT * FROM notifications
+WHERE user_id = sqlc.arg('user_id')
+  AND (NOT sqlc.arg('unread_only')::BOOLEAN OR read_at IS NULL)
+  AND (sqlc.narg('before')::TIMESTAMPTZ IS NULL OR (updated_at, id) < (sqlc.narg('before'), sqlc.arg('before_id')::UUID))
+ORDER BY updated_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: CountUnreadNotifications :one
+SELECT COUNT(*) FROM notifications
+WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: MarkNotificationRead :one
+UPDATE notifications
+SET read_at = COALESCE(read_at, NOW())
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: MarkAllNotificationsRead :exec
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL;
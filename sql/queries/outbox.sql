@@ -0,0 +1,37 @@
+-- name: InsertOutboxEvent :exec
+INSERT INTO outbox (id, created_at, event_type, user_id, payload, available_at)
+VALUES ($1, $2, $3, $4, $5, NOW());
+
+-- name: ClaimOutboxEvents :many
+SELECT * FROM outbox
+WHERE published_at IS NULL AND available_at <= NOW()
+ORDER BY created_at
+LIMIT $1
+FOR NO KEY UPDATE SKIP LOCKED;
+
+-- name: MarkOutboxEventPublished :exec
+UPDATE outbox
+SET published_at = NOW(), attempts = attempts + 1, last_error = NULL
+WHERE id = $1;
+
+-- name: MarkOutboxEventFailed :exec
+UPDATE outbox
+SET attempts = attempts + 1, last_error = $2,
+  available_at = NOW() + LEAST(attempts + 1, 60) * INTERVAL '10 seconds'
+WHERE id = $1;
+
+-- name: RecordOutboxDelivery :execrows
+INSERT INTO outbox_deliveries (event_id, sink, delivered_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (event_id, sink) DO NOTHING;
+
+-- name: DeletePublishedOutboxEvents :exec
+DELETE FROM outbox
+WHERE published_at < $1;
+
+-- name: GetOutboxEvent :one
+SELECT * FROM outbox
+WHERE id = $1;
+
+-- name: NotifyOutboxEvent :exec
+SELECT pg_notify(sqlc.arg('channel')::TEXT, sqlc.arg('payload')::TEXT);
@@ -8,3 +8,12 @@ SELECT * FROM refresh_tokens WHERE token = $1 LIMIT 1;
 
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE token = $1;
+
+-- name: CountActiveRefreshTokens :one
+SELECT COUNT(*) FROM refresh_tokens
+WHERE revoked_at IS NULL AND expires_at > NOW();
+
+-- name: GetRefreshTokensByUser :many
+SELECT * FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at;
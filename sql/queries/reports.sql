@@ -0,0 +1,46 @@
+-- name: CreateReport :one
+INSERT INTO reports(id, created_at, updated_at, chirp_id, reported_user_id, reporter_id, reason, details)
+VALUES (
+  gen_random_uuid(), NOW(), NOW(), sqlc.arg('chirp_id')::UUID, sqlc.arg('reported_user_id'),
+  sqlc.arg('reporter_id'), sqlc.arg('reason'), sqlc.arg('details')
+)
+ON CONFLICT (chirp_id, reporter_id) DO NOTHING
+RETURNING *;
+
+-- name: GetReport :one
+SELECT * FROM reports
+WHERE id = $1;
+
+-- name: GetReports :many
+SELECT * FROM reports
+WHERE status = $1
+ORDER BY created_at
+LIMIT $2;
+
+-- name: TriageReport :one
+UPDATE reports
+SET status = 'triaged', assignee_id = sqlc.arg('assignee_id')::UUID, updated_at = NOW()
+WHERE id = sqlc.arg('id') AND status <> 'resolved'
+RETURNING *;
+
+-- name: ResolveReport :one
+UPDATE reports
+SET status = 'resolved', resolution = sqlc.arg('resolution')::TEXT, resolved_at = NOW(), updated_at = NOW()
+WHERE id = sqlc.arg('id') AND status <> 'resolved'
+RETURNING *;
+
+-- name: CreateModerationAction :exec
+INSERT INTO moderation_actions(id, created_at, moderator_id, action, report_id, chirp_id, target_user_id, note)
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3, $4, $5, $6);
+
+-- name: GetModerationActions :many
+SELECT * FROM moderation_actions
+WHERE (sqlc.narg('report_id')::UUID IS NULL OR report_id = sqlc.narg('report_id'))
+  AND (sqlc.narg('target_user_id')::UUID IS NULL OR target_user_id = sqlc.narg('target_user_id'))
+ORDER BY created_at DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetWarningsByUser :many
+SELECT * FROM moderation_actions
+WHERE target_user_id = $1 AND action = 'warn_user'
+ORDER BY created_at DESC;
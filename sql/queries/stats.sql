@@ -0,0 +1,23 @@
+-- name: AddStat :exec
+INSERT INTO daily_stats (day, metric, count)
+VALUES ((NOW() AT TIME ZONE 'UTC')::DATE, $1, $2)
+ON CONFLICT (day, metric) DO UPDATE SET count = daily_stats.count + EXCLUDED.count;
+
+-- name: GetStatsSince :many
+SELECT * FROM daily_stats
+WHERE day >= $1
+ORDER BY day, metric;
+
+-- name: GetStatTotals :many
+SELECT metric, SUM(count)::BIGINT AS total FROM daily_stats
+GROUP BY metric;
+
+-- name: DeleteStats :exec
+DELETE FROM daily_stats;
+
+-- name: CountUsers :one
+SELECT COUNT(*) FROM users;
+
+-- name: CountChirps :one
+SELECT COUNT(*) FROM chirps
+WHERE published;
@@ -0,0 +1,15 @@
+-- name: CreateUserSuspension :one
+INSERT INTO user_suspensions(id, created_at, user_id, reason, expires_at)
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3)
+RETURNING *;
+
+-- name: GetActiveSuspension :one
+SELECT * FROM user_suspensions
+WHERE user_id = $1 AND lifted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+ORDER BY expires_at DESC NULLS FIRST
+LIMIT 1;
+
+-- name: LiftSuspensions :execrows
+UPDATE user_suspensions
+SET lifted_at = NOW()
+WHERE user_id = $1 AND lifted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW());
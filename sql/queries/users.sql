@@ -1,6 +1,6 @@
 -- name: CreateUser :one
-INSERT INTO users(id, created_at, updated_at, email, hashed_password)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
+INSERT INTO users(id, created_at, updated_at, email, hashed_password, username)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3)
 RETURNING *;
 
 -- name: DeleteUsers :exec
@@ -14,13 +14,75 @@ WHERE email = $1;
 SELECT * FROM users
 WHERE id = $1;
 
+-- name: GetUserByUsername :one
+SELECT * FROM users
+WHERE username = $1;
+
 -- name: UpdateUser :one
 UPDATE users
-SET hashed_password = $2, email = $3, updated_at = NOW()
+SET hashed_password = $2, email = $3, username = COALESCE(sqlc.narg('username'), username), updated_at = NOW()
 WHERE id = $1
 RETURNING *;
 
+-- name: UpdateUserProfile :one
+UPDATE users
+SET display_name = $2, bio = $3, avatar_media_id = $4, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: DeactivateUser :execrows
+UPDATE users
+SET deactivated_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND deactivated_at IS NULL;
+
+-- name: ReactivateUser :execrows
+UPDATE users
+SET deactivated_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deactivated_at IS NOT NULL;
+
 -- name: UpgradeUserRedChirp :one
 UPDATE users
-SET is_chirpy_red = true WHERE id = $1
+SET is_chirpy_red = true,
+  red_started_at = CASE WHEN is_chirpy_red THEN COALESCE(red_started_at, NOW()) ELSE NOW() END,
+  red_ends_at = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: DowngradeUserRedChirp :one
+UPDATE users
+SET is_chirpy_red = false, red_ends_at = NOW(), updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: CancelUserRedChirp :one
+UPDATE users
+SET red_ends_at = COALESCE(sqlc.narg('ends_at'), red_ends_at, NOW()), updated_at = NOW()
+WHERE id = $1 AND is_chirpy_red
+RETURNING *;
+
+-- name: ExpireRedChirpMemberships :many
+UPDATE users
+SET is_chirpy_red = false, updated_at = NOW()
+WHERE is_chirpy_red AND red_ends_at <= NOW()
+RETURNING id;
+
+-- name: ScheduleUserDeletion :one
+UPDATE users
+SET deletion_scheduled_at = $2, updated_at = NOW()
+WHERE id = $1
 RETURNING *;
+
+-- name: CancelUserDeletion :execrows
+UPDATE users
+SET deletion_scheduled_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deletion_scheduled_at > NOW();
+
+-- name: GetUsersDueForDeletion :many
+SELECT id FROM users
+WHERE deletion_scheduled_at <= NOW()
+ORDER BY deletion_scheduled_at
+LIMIT $1;
+
+-- name: DeleteUser :execrows
+DELETE FROM users
+WHERE id = $1 AND deletion_scheduled_at <= NOW();
@@ -0,0 +1,14 @@
+-- name: RecordWebhookEvent :exec
+INSERT INTO webhook_events (id, source, event_type, payload, received_at)
+VALUES ($1, $2, $3, $4, NOW())
+ON CONFLICT (source, id) DO NOTHING;
+
+-- name: CompleteWebhookEvent :execrows
+UPDATE webhook_events
+SET status = $3, processed_at = NOW(), last_error = NULL
+WHERE source = $1 AND id = $2 AND status NOT IN ('processed', 'ignored');
+
+-- name: FailWebhookEvent :exec
+UPDATE webhook_events
+SET status = 'failed', last_error = $3
+WHERE source = $1 AND id = $2 AND status NOT IN ('processed', 'ignored');
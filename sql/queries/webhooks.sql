@@ -0,0 +1,60 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (id, created_at, user_id, url, secret, events, is_global)
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetWebhookEndpoint :one
+SELECT * FROM webhook_endpoints
+WHERE id = $1;
+
+-- name: GetWebhookEndpointsByUser :many
+SELECT * FROM webhook_endpoints
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: GetWebhookEndpointsForEvent :many
+SELECT * FROM webhook_endpoints
+WHERE sqlc.arg('event')::TEXT = ANY(events) AND (is_global OR user_id = sqlc.arg('user_id'));
+
+-- name: DeleteWebhookEndpoint :exec
+DELETE FROM webhook_endpoints
+WHERE id = $1;
+
+-- name: CreateWebhookDelivery :exec
+INSERT INTO webhook_deliveries (id, created_at, updated_at, endpoint_id, event_type, payload, status, next_attempt_at)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, 'pending', NOW());
+
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries d
+SET next_attempt_at = sqlc.arg('leased_until'), updated_at = NOW()
+FROM webhook_endpoints e
+WHERE e.id = d.endpoint_id AND d.id IN (
+  SELECT id FROM webhook_deliveries
+  WHERE status = 'pending' AND next_attempt_at <= NOW()
+  ORDER BY next_attempt_at
+  LIMIT sqlc.arg('limit')
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING d.id, d.event_type, d.payload, d.attempts, e.url, e.secret;
+
+-- name: MarkWebhookDeliverySucceeded :exec
+UPDATE webhook_deliveries
+SET status = 'succeeded', attempts = attempts + 1, last_status_code = $2, last_error = NULL, updated_at = NOW()
+WHERE id = $1;
+
+-- name: MarkWebhookDeliveryFailed :exec
+UPDATE webhook_deliveries
+SET status = $2, attempts = attempts + 1, next_attempt_at = $3, last_status_code = $4, last_error = $5, updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE endpoint_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: RetryWebhookDelivery :one
+UPDATE webhook_deliveries
+SET status = 'pending', attempts = 0, next_attempt_at = NOW(), last_status_code = NULL, last_error = NULL, updated_at = NOW()
+WHERE id = $1 AND endpoint_id = $2
+RETURNING *;
@@ -0,0 +1,16 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE daily_stats (
+  day DATE NOT NULL,
+  metric TEXT NOT NULL,
+  count BIGINT NOT NULL DEFAULT 0,
+  PRIMARY KEY (day, metric)
+);
+
+-- +goose Down
+DROP TABLE daily_stats;
+
+ALTER TABLE users
+DROP COLUMN is_admin;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN red_started_at TIMESTAMPTZ,
+ADD COLUMN red_ends_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN red_started_at,
+DROP COLUMN red_ends_at;
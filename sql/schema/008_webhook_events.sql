@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE webhook_events (
+  id TEXT NOT NULL,
+  source TEXT NOT NULL,
+  event_type TEXT NOT NULL,
+  payload TEXT NOT NULL,
+  received_at TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY (source, id)
+);
+
+-- +goose Down
+DROP TABLE webhook_events;
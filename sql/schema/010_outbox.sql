@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE outbox (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL,
+  event_type TEXT NOT NULL,
+  user_id UUID NOT NULL,
+  payload TEXT NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  available_at TIMESTAMPTZ NOT NULL,
+  published_at TIMESTAMPTZ,
+  last_error TEXT
+);
+
+CREATE INDEX outbox_unpublished_idx ON outbox (available_at)
+WHERE published_at IS NULL;
+
+-- +goose Down
+DROP TABLE outbox;
@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN publish_at TIMESTAMPTZ,
+ADD COLUMN published BOOLEAN NOT NULL DEFAULT TRUE;
+
+CREATE INDEX chirps_scheduled_idx ON chirps (publish_at)
+WHERE NOT published;
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN publish_at,
+DROP COLUMN published;
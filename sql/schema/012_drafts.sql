@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE drafts (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL,
+  body TEXT NOT NULL,
+  user_id UUID NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX drafts_user_id_idx ON drafts (user_id);
+
+-- +goose Down
+DROP TABLE drafts;
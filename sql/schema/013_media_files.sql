@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE media_files (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL,
+  user_id UUID NOT NULL,
+  chirp_id UUID,
+  storage_key TEXT NOT NULL,
+  content_type TEXT NOT NULL,
+  size_bytes BIGINT NOT NULL,
+  width INTEGER NOT NULL,
+  height INTEGER NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE SET NULL
+);
+
+CREATE INDEX media_files_chirp_id_idx ON media_files (chirp_id);
+
+CREATE INDEX media_files_unattached_idx ON media_files (created_at)
+WHERE chirp_id IS NULL;
+
+-- +goose Down
+DROP TABLE media_files;
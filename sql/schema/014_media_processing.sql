@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE media_files
+ADD COLUMN status TEXT NOT NULL DEFAULT 'ready',
+ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+ADD COLUMN last_error TEXT;
+
+CREATE INDEX media_files_unprocessed_idx ON media_files (created_at)
+WHERE status IN ('pending', 'processing');
+
+CREATE TABLE media_variants (
+  media_file_id UUID NOT NULL,
+  name TEXT NOT NULL,
+  storage_key TEXT NOT NULL,
+  content_type TEXT NOT NULL,
+  width INTEGER NOT NULL,
+  height INTEGER NOT NULL,
+  PRIMARY KEY (media_file_id, name),
+  FOREIGN KEY (media_file_id) REFERENCES media_files(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE media_variants;
+
+ALTER TABLE media_files
+DROP COLUMN status,
+DROP COLUMN updated_at,
+DROP COLUMN last_error;
@@ -0,0 +1,31 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN username TEXT UNIQUE;
+
+CREATE TABLE chirp_mentions (
+  chirp_id UUID NOT NULL,
+  user_id UUID NOT NULL,
+  handle TEXT NOT NULL,
+  PRIMARY KEY (chirp_id, user_id),
+  FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX chirp_mentions_user_id_idx ON chirp_mentions (user_id);
+
+CREATE TABLE chirp_hashtags (
+  chirp_id UUID NOT NULL,
+  tag TEXT NOT NULL,
+  PRIMARY KEY (chirp_id, tag),
+  FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX chirp_hashtags_tag_idx ON chirp_hashtags (tag);
+
+-- +goose Down
+DROP TABLE chirp_hashtags;
+
+DROP TABLE chirp_mentions;
+
+ALTER TABLE users
+DROP COLUMN username;
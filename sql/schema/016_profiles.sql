@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN display_name TEXT NOT NULL DEFAULT '',
+ADD COLUMN bio TEXT NOT NULL DEFAULT '',
+ADD COLUMN avatar_media_id UUID REFERENCES media_files(id) ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN display_name,
+DROP COLUMN bio,
+DROP COLUMN avatar_media_id;
@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE notifications (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL,
+  user_id UUID NOT NULL,
+  type TEXT NOT NULL,
+  chirp_id UUID,
+  actor_ids UUID[] NOT NULL,
+  actor_count INTEGER NOT NULL,
+  read_at TIMESTAMPTZ,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_user_id_idx ON notifications (user_id, updated_at DESC);
+
+-- Actions of the same type on the same chirp are grouped into a single
+-- unread notification.
+CREATE UNIQUE INDEX notifications_unread_group_idx
+ON notifications (user_id, type, COALESCE(chirp_id, '00000000-0000-0000-0000-000000000000'::UUID))
+WHERE read_at IS NULL;
+
+-- +goose Down
+DROP TABLE notifications;
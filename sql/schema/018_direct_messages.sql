@@ -0,0 +1,54 @@
+-- +goose Up
+CREATE TABLE conversations (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL,
+  is_group BOOLEAN NOT NULL,
+  -- direct_key identifies one-to-one conversations by their sorted
+  -- participants, so there is at most one per pair of users.
+  direct_key TEXT UNIQUE
+);
+
+CREATE TABLE conversation_participants (
+  conversation_id UUID NOT NULL,
+  user_id UUID NOT NULL,
+  joined_at TIMESTAMPTZ NOT NULL,
+  last_read_at TIMESTAMPTZ,
+  PRIMARY KEY (conversation_id, user_id),
+  FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX conversation_participants_user_id_idx ON conversation_participants (user_id);
+
+CREATE TABLE messages (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL,
+  conversation_id UUID NOT NULL,
+  sender_id UUID NOT NULL,
+  body TEXT NOT NULL,
+  FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+  FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX messages_conversation_id_idx ON messages (conversation_id, created_at DESC, id DESC);
+
+CREATE TABLE user_blocks (
+  blocker_id UUID NOT NULL,
+  blocked_id UUID NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY (blocker_id, blocked_id),
+  FOREIGN KEY (blocker_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (blocked_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX user_blocks_blocked_id_idx ON user_blocks (blocked_id);
+
+-- +goose Down
+DROP TABLE user_blocks;
+
+DROP TABLE messages;
+
+DROP TABLE conversation_participants;
+
+DROP TABLE conversations;
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE user_mutes (
+  muter_id UUID NOT NULL,
+  muted_id UUID NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY (muter_id, muted_id),
+  FOREIGN KEY (muter_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (muted_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE user_mutes;
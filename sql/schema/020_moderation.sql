@@ -0,0 +1,66 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN hidden_at TIMESTAMPTZ;
+
+-- Reports outlive the chirps deleted by moderators, so the reported user is
+-- kept alongside the chirp.
+CREATE TABLE reports (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL,
+  chirp_id UUID,
+  reported_user_id UUID NOT NULL,
+  reporter_id UUID NOT NULL,
+  reason TEXT NOT NULL,
+  details TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL DEFAULT 'open',
+  assignee_id UUID,
+  resolution TEXT,
+  resolved_at TIMESTAMPTZ,
+  UNIQUE (chirp_id, reporter_id),
+  FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE SET NULL,
+  FOREIGN KEY (reported_user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (assignee_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX reports_status_idx ON reports (status, created_at);
+
+-- moderation_actions is the audit trail of moderators. It has no foreign
+-- keys on chirps and users so that it survives their deletion.
+CREATE TABLE moderation_actions (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL,
+  moderator_id UUID NOT NULL,
+  action TEXT NOT NULL,
+  report_id UUID,
+  chirp_id UUID,
+  target_user_id UUID,
+  note TEXT NOT NULL DEFAULT '',
+  FOREIGN KEY (report_id) REFERENCES reports(id) ON DELETE SET NULL
+);
+
+CREATE INDEX moderation_actions_report_id_idx ON moderation_actions (report_id);
+
+CREATE INDEX moderation_actions_target_user_id_idx ON moderation_actions (target_user_id, created_at DESC);
+
+CREATE TABLE user_suspensions (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL,
+  user_id UUID NOT NULL,
+  reason TEXT NOT NULL,
+  expires_at TIMESTAMPTZ,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX user_suspensions_user_id_idx ON user_suspensions (user_id);
+
+-- +goose Down
+DROP TABLE user_suspensions;
+
+DROP TABLE moderation_actions;
+
+DROP TABLE reports;
+
+ALTER TABLE chirps
+DROP COLUMN hidden_at;
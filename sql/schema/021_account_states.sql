@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN deactivated_at TIMESTAMPTZ;
+
+ALTER TABLE user_suspensions
+ADD COLUMN lifted_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE user_suspensions
+DROP COLUMN lifted_at;
+
+ALTER TABLE users
+DROP COLUMN deactivated_at;
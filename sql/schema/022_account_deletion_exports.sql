@@ -0,0 +1,29 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN deletion_scheduled_at TIMESTAMPTZ;
+
+CREATE INDEX users_deletion_scheduled_at_idx ON users (deletion_scheduled_at)
+WHERE deletion_scheduled_at IS NOT NULL;
+
+CREATE TABLE data_exports (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL,
+  user_id UUID NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending',
+  storage_key TEXT,
+  last_error TEXT,
+  expires_at TIMESTAMPTZ,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX data_exports_user_id_idx ON data_exports (user_id, created_at DESC);
+
+CREATE INDEX data_exports_pending_idx ON data_exports (created_at)
+WHERE status IN ('pending', 'processing');
+
+-- +goose Down
+DROP TABLE data_exports;
+
+ALTER TABLE users
+DROP COLUMN deletion_scheduled_at;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- Events recorded before outcomes were tracked had all been processed.
+ALTER TABLE webhook_events
+ADD COLUMN status TEXT NOT NULL DEFAULT 'processed',
+ADD COLUMN processed_at TIMESTAMPTZ,
+ADD COLUMN last_error TEXT;
+
+ALTER TABLE webhook_events
+ALTER COLUMN status SET DEFAULT 'received';
+
+-- +goose Down
+ALTER TABLE webhook_events
+DROP COLUMN last_error,
+DROP COLUMN processed_at,
+DROP COLUMN status;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- Sinks that already handled an event are skipped when it is retried.
+CREATE TABLE outbox_deliveries (
+  event_id UUID NOT NULL REFERENCES outbox (id) ON DELETE CASCADE,
+  sink TEXT NOT NULL,
+  delivered_at TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY (event_id, sink)
+);
+
+-- +goose Down
+DROP TABLE outbox_deliveries;
@@ -0,0 +1,25 @@
+-- +goose Up
+-- Unread notifications are grouped on group_key rather than on the chirp, so
+-- that types whose chirps all have a different actor, like mentions, can be
+-- grouped per user. Existing notifications keep their chirp as their group.
+ALTER TABLE notifications
+ADD COLUMN group_key TEXT NOT NULL DEFAULT '';
+
+UPDATE notifications
+SET group_key = COALESCE(chirp_id::TEXT, '');
+
+DROP INDEX notifications_unread_group_idx;
+
+CREATE UNIQUE INDEX notifications_unread_group_idx
+ON notifications (user_id, type, group_key)
+WHERE read_at IS NULL;
+
+-- +goose Down
+DROP INDEX notifications_unread_group_idx;
+
+CREATE UNIQUE INDEX notifications_unread_group_idx
+ON notifications (user_id, type, COALESCE(chirp_id, '00000000-0000-0000-0000-000000000000'::UUID))
+WHERE read_at IS NULL;
+
+ALTER TABLE notifications
+DROP COLUMN group_key;